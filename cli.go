@@ -0,0 +1,327 @@
+package main
+
+import (
+	"bytes"
+	_ "embed"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"strings"
+)
+
+// version is set with -ldflags "-X main.version=v1.2.3",
+// otherwise the module version of the build is used.
+var version = ""
+
+//go:embed config.schema.json
+var configSchema []byte
+
+const usage = `usage: sql <command> [flags]
+
+commands:
+  generate  process the SQL files and write the generated Go files
+  check     report generated Go files which are not up to date
+  vet       process the SQL files without writing anything
+  init      create a config file and its JSON schema
+  version   print the version
+
+Run sql <command> -h for the flags of a command.
+`
+
+var (
+	errUsage        = errors.New("invalid usage")
+	errNotUpToDate  = errors.New("generated files are not up to date, run sql generate")
+	errConfigExists = errors.New("config file already exists")
+)
+
+type commandFunc func(args []string, stdout, stderr io.Writer) error
+
+var commands = map[string]commandFunc{
+	"generate": generateCommand,
+	"check":    checkCommand,
+	"vet":      vetCommand,
+	"init":     initCommand,
+	"version":  versionCommand,
+}
+
+// runCommand returns the exit code: 0 on success,
+// 1 on errors (e.g. outdated files with check) and 2 on invalid usage.
+func runCommand(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, usage)
+		return 2
+	}
+	name, args := args[0], args[1:]
+	command, ok := commands[name]
+	switch {
+	case name == "help" || name == "-h" || name == "-help" || name == "--help":
+		fmt.Fprint(stdout, usage)
+		return 0
+	case !ok && isConfigPath(name) && len(args) == 0:
+		// the config file as the only argument,
+		// as before the introduction of the commands
+		command, args = generateCommand, []string{"-config", name}
+	case !ok:
+		fmt.Fprintf(stderr, "unknown command %q\n\n%s", name, usage)
+		return 2
+	}
+
+	err := command(args, stdout, stderr)
+	switch {
+	case err == nil:
+		return 0
+	case errors.Is(err, flag.ErrHelp):
+		return 0
+	case errors.Is(err, errUsage):
+		return 2
+	default:
+		fmt.Fprintf(stderr, "error: %v\n", err)
+		return 1
+	}
+}
+
+func isConfigPath(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json", ".yaml", ".yml", ".toml":
+		return true
+	default:
+		return false
+	}
+}
+
+// patternList is a flag which can be repeated,
+// the values can also be separated by commas.
+type patternList []string
+
+func (l *patternList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *patternList) Set(value string) error {
+	for _, pattern := range strings.Split(value, ",") {
+		if pattern = strings.TrimSpace(pattern); pattern != "" {
+			*l = append(*l, pattern)
+		}
+	}
+	return nil
+}
+
+// options are the flags of generate, check and vet.
+type options struct {
+	config    string
+	outputDir string
+	verbose   bool
+	only      patternList
+}
+
+func parseFlags(name string, args []string, stderr io.Writer, o *options) error {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.StringVar(&o.config, "config", "config.json", "path of the config file (.json, .yaml or .toml)")
+	if name != "init" {
+		flags.StringVar(&o.outputDir, "output-dir", "", "resolve relative output paths against this directory")
+		flags.BoolVar(&o.verbose, "v", false, "print the processed and generated files")
+		flags.Var(&o.only, "only", "only generate the packages of SQL files matching the glob `patterns`")
+	}
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return err
+		}
+		return errUsage
+	}
+	if flags.NArg() > 0 {
+		fmt.Fprintf(stderr, "unexpected arguments %q\n", flags.Args())
+		flags.Usage()
+		return errUsage
+	}
+	return nil
+}
+
+// build processes the SQL files with the flags of the command.
+func build(name string, args []string, stderr io.Writer) ([]generatedFile, error) {
+	var o options
+	if err := parseFlags(name, args, stderr, &o); err != nil {
+		return nil, err
+	}
+	config, err := loadConfig(o.config)
+	if err != nil {
+		return nil, err
+	}
+	b, err := newBuilder(config)
+	if err != nil {
+		return nil, err
+	}
+	defer b.Close()
+	b.outputDir, b.verbose, b.log = o.outputDir, o.verbose, stderr
+	return b.generateFiles(o.only)
+}
+
+func generateCommand(args []string, stdout, stderr io.Writer) error {
+	files, err := build("generate", args, stderr)
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		if err := os.MkdirAll(filepath.Dir(f.path), 0o755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(f.path, f.source, 0o644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func checkCommand(args []string, stdout, stderr io.Writer) error {
+	files, err := build("check", args, stderr)
+	if err != nil {
+		return err
+	}
+	return checkFiles(files, stderr)
+}
+
+// checkFiles compares the generated files with the files on disk,
+// generated files without a source in the output directories are reported too.
+func checkFiles(files []generatedFile, stderr io.Writer) error {
+	upToDate := true
+	generated, seenDirs := make(map[string]bool), make(map[string]bool)
+	var dirs []string
+	for _, f := range files {
+		generated[filepath.Clean(f.path)] = true
+		if dir := filepath.Dir(f.path); !seenDirs[dir] {
+			seenDirs[dir] = true
+			dirs = append(dirs, dir)
+		}
+	}
+	for _, f := range files {
+		existing, err := os.ReadFile(f.path)
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+			fmt.Fprintf(stderr, "%s: missing\n", f.path)
+			upToDate = false
+		case err != nil:
+			return err
+		case !bytes.Equal(existing, f.source):
+			fmt.Fprintf(stderr, "%s: not up to date\n", f.path)
+			upToDate = false
+		}
+	}
+	for _, dir := range dirs {
+		stale, err := staleFiles(dir, generated)
+		if err != nil {
+			return err
+		}
+		for _, path := range stale {
+			fmt.Fprintf(stderr, "%s: no longer generated\n", path)
+			upToDate = false
+		}
+	}
+	if !upToDate {
+		return errNotUpToDate
+	}
+	return nil
+}
+
+// staleFiles returns the Go files in dir with the generated header
+// which are not part of the generated files.
+func staleFiles(dir string, generated map[string]bool) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var stale []string
+	for _, entry := range entries {
+		path := filepath.Join(dir, entry.Name())
+		if !entry.Type().IsRegular() || filepath.Ext(path) != ".go" || generated[path] {
+			continue
+		}
+		source, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if bytes.HasPrefix(source, []byte(generatedHeader)) {
+			stale = append(stale, path)
+		}
+	}
+	return stale, nil
+}
+
+func vetCommand(args []string, stdout, stderr io.Writer) error {
+	_, err := build("vet", args, stderr)
+	return err
+}
+
+const configTemplate = `{
+    "$schema": "config.schema.json",
+    "Address": "localhost:5432",
+    "Username": "postgres",
+    "Password": "",
+    "Database": "postgres",
+    "SQLFiles": [
+        "queries/**/*.sql"
+    ],
+    "Output": "queries/queries.gen.go",
+    "Package": "queries"
+}
+`
+
+// initCommand writes a config file and the JSON schema next to it,
+// existing config files are not overwritten.
+func initCommand(args []string, stdout, stderr io.Writer) error {
+	var o options
+	if err := parseFlags("init", args, stderr, &o); err != nil {
+		return err
+	}
+	if filepath.Ext(o.config) != ".json" {
+		return fmt.Errorf("%s: init only creates .json config files", o.config)
+	}
+	if _, err := os.Stat(o.config); err == nil {
+		return fmt.Errorf("%s: %w", o.config, errConfigExists)
+	}
+	if err := os.MkdirAll(filepath.Dir(o.config), 0o755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(o.config, []byte(configTemplate), 0o644); err != nil {
+		return err
+	}
+	schemaPath := filepath.Join(filepath.Dir(o.config), "config.schema.json")
+	if _, err := os.Stat(schemaPath); errors.Is(err, fs.ErrNotExist) {
+		if err := os.WriteFile(schemaPath, configSchema, 0o644); err != nil {
+			return err
+		}
+	}
+	fmt.Fprintf(stdout, "created %s, set the connection and the SQL files\n", o.config)
+	return nil
+}
+
+func versionCommand(args []string, stdout, stderr io.Writer) error {
+	flags := flag.NewFlagSet("version", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return err
+		}
+		return errUsage
+	}
+	if flags.NArg() > 0 {
+		fmt.Fprintf(stderr, "unexpected arguments %q\n", flags.Args())
+		return errUsage
+	}
+	v := version
+	if v == "" {
+		v = "(devel)"
+		if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" {
+			v = info.Main.Version
+		}
+	}
+	fmt.Fprintf(stdout, "sql %s\n", v)
+	return nil
+}
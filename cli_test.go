@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestRunCommand(t *testing.T) {
+	tests := []struct {
+		args   []string
+		code   int
+		output string
+	}{
+		{nil, 2, "usage: sql <command>"},
+		{[]string{"help"}, 0, "usage: sql <command>"},
+		{[]string{"unknown"}, 2, `unknown command "unknown"`},
+		{[]string{"version"}, 0, "sql "},
+		{[]string{"version", "extra"}, 2, ""},
+		{[]string{"generate", "-unknown"}, 2, "flag provided but not defined"},
+		{[]string{"check", "-config", "c.json", "extra"}, 2, "unexpected arguments"},
+		{[]string{"vet", "-h"}, 0, "-only patterns"},
+		{[]string{"vet", "-config", filepath.Join(t.TempDir(), "missing.json")}, 1, "error: "},
+	}
+	for _, tt := range tests {
+		var stdout, stderr bytes.Buffer
+		code := runCommand(tt.args, &stdout, &stderr)
+		if code != tt.code {
+			t.Fatalf("%q: got exit code %d, expected %d\n%s%s", tt.args, code, tt.code, stdout.String(), stderr.String())
+		}
+		if !strings.Contains(stdout.String()+stderr.String(), tt.output) {
+			t.Fatalf("%q: missing %q in:\n%s%s", tt.args, tt.output, stdout.String(), stderr.String())
+		}
+	}
+}
+
+func TestInitCommand(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	var stdout, stderr bytes.Buffer
+	if code := runCommand([]string{"init", "-config", path}, &stdout, &stderr); code != 0 {
+		t.Fatalf("got exit code %d: %s", code, stderr.String())
+	}
+	schema, err := os.ReadFile(filepath.Join(filepath.Dir(path), "config.schema.json"))
+	if err != nil || !bytes.Equal(schema, configSchema) {
+		t.Fatalf("schema not written: %v", err)
+	}
+	c, err := loadConfig(path)
+	if err == nil || !strings.Contains(err.Error(), "$.SQLFiles[0]: pattern") {
+		// the scaffold is valid apart from the missing SQL files
+		t.Fatalf("got %+v, %v", c, err)
+	}
+
+	stderr.Reset()
+	if code := runCommand([]string{"init", "-config", path}, &stdout, &stderr); code != 1 ||
+		!strings.Contains(stderr.String(), errConfigExists.Error()) {
+		t.Fatalf("got exit code %d: %s", code, stderr.String())
+	}
+}
+
+func TestCheckFiles(t *testing.T) {
+	dir := t.TempDir()
+	current := filepath.Join(dir, "current.go")
+	outdated := filepath.Join(dir, "outdated.go")
+	if err := os.WriteFile(current, []byte("package a\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(outdated, []byte("package a\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var stderr bytes.Buffer
+	if err := checkFiles([]generatedFile{{path: current, source: []byte("package a\n")}}, &stderr); err != nil {
+		t.Fatal(err)
+	}
+	err := checkFiles([]generatedFile{
+		{path: current, source: []byte("package a\n")},
+		{path: outdated, source: []byte("package a\n\nconst x = 1\n")},
+		{path: filepath.Join(dir, "missing.go"), source: []byte("package a\n")},
+	}, &stderr)
+	if err != errNotUpToDate {
+		t.Fatalf("expected errNotUpToDate, got %v", err)
+	}
+	output := stderr.String()
+	if strings.Contains(output, "current.go") ||
+		!strings.Contains(output, "outdated.go: not up to date") ||
+		!strings.Contains(output, "missing.go: missing") {
+		t.Fatalf("got %s", output)
+	}
+
+	// removed.go was generated from a SQL file which no longer exists
+	removed := filepath.Join(dir, "removed.go")
+	if err := os.WriteFile(removed, []byte(generatedHeader+"\npackage a\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	stderr.Reset()
+	err = checkFiles([]generatedFile{{path: current, source: []byte("package a\n")}}, &stderr)
+	if err != errNotUpToDate {
+		t.Fatalf("expected errNotUpToDate, got %v", err)
+	}
+	output = stderr.String()
+	if !strings.Contains(output, "removed.go: no longer generated") ||
+		strings.Contains(output, "outdated.go") {
+		t.Fatalf("got %s", output)
+	}
+}
+
+func TestPatternList(t *testing.T) {
+	var l patternList
+	_ = l.Set("a/*.sql, b/**/*.sql")
+	_ = l.Set("c.sql")
+	if l.String() != "a/*.sql,b/**/*.sql,c.sql" {
+		t.Fatalf("got %q", l.String())
+	}
+}
+
+func TestSelectSQLFiles(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"person/a.sql": "--! output person/a.gen.go\n",
+		"person/b.sql": "--! output person/b.gen.go\n",
+		"order/c.sql":  "--! output order/c.gen.go\n",
+	}
+	var sqlFiles []string
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		sqlFiles = append(sqlFiles, path)
+	}
+	sort.Strings(sqlFiles)
+
+	b := &builder{config: &config{Package: "queries"}}
+	selected, err := b.selectSQLFiles(sqlFiles, []string{filepath.ToSlash(dir) + "/person/a.sql"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// b.sql is generated into the same package
+	expected := []string{filepath.Join(dir, "person", "a.sql"), filepath.Join(dir, "person", "b.sql")}
+	if strings.Join(selected, " ") != strings.Join(expected, " ") {
+		t.Fatalf("got %q, expected %q", selected, expected)
+	}
+
+	if _, err := b.selectSQLFiles(sqlFiles, []string{"none.sql"}); err != errNoSelectedFiles {
+		t.Fatalf("expected errNoSelectedFiles, got %v", err)
+	}
+}
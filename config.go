@@ -0,0 +1,321 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/token"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// config is read from JSON, YAML (.yaml, .yml) or TOML (.toml).
+// config.schema.json describes the format for editors.
+type config struct {
+	Schema string `json:"$schema"` // ignored
+
+	Address  string
+	Username string
+	Password string
+	Database string
+
+	// Files, directories (all .sql files, recursively)
+	// or glob patterns like queries/**/*.sql.
+	SQLFiles        []string
+	ExcludeSQLFiles []string // glob patterns
+
+	// Encoding of the SQL files: utf-8 (default), latin1 or windows-1252.
+	Encoding string
+
+	Output  string // path of the generated Go file
+	Package string // package name of the generated Go file
+
+	// Overrides Output and Package for SQL files matching the pattern,
+	// the first match is used. Directives in the SQL files
+	// (e.g. --! package person) take precedence.
+	Files []FileConfig
+
+	DomainTypes bool // generate a named Go type for every domain
+
+	// Go type of nullable values: pointer (*T, default),
+	// null (postgres.Null[T]) or sql (database/sql.Null*).
+	Nullable string
+
+	// A row struct is generated for every table and view
+	// in these schemas, declarations can use it as their result.
+	Tables []string
+
+	// Overrides the Go type of a Postgres type by name,
+	// optionally qualified with the schema (e.g. public.citext).
+	Types map[string]TypeInfo
+}
+
+type FileConfig struct {
+	Pattern string // same syntax as SQLFiles, e.g. person/**/*.sql
+	Output  string
+	Package string
+	Imports []string // package paths, referenced by name in the headers
+}
+
+type TypeInfo struct {
+	Go       string // package path as prefix if any
+	Nullable string // overrides config.Nullable
+}
+
+// UnmarshalJSON also accepts the Go type as a plain string.
+func (t *TypeInfo) UnmarshalJSON(b []byte) error {
+	if len(b) > 0 && b[0] == '"' {
+		return json.Unmarshal(b, &t.Go)
+	}
+	type typeInfo TypeInfo
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	return dec.Decode((*typeInfo)(t))
+}
+
+func loadConfig(path string) (*config, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// YAML and TOML are converted to JSON,
+	// so every format is decoded the same way
+	var generic interface{}
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".json":
+	case ".yaml", ".yml":
+		if err := yaml.Unmarshal(b, &generic); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	case ".toml":
+		if _, err := toml.Decode(string(b), &generic); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	default:
+		return nil, fmt.Errorf("%s: unknown config format %q, expected .json, .yaml or .toml", path, ext)
+	}
+	if generic != nil {
+		if b, err = json.Marshal(generic); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	var c config
+	if err := dec.Decode(&c); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, decodeError(b, err))
+	}
+	if err := c.validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &c, nil
+}
+
+// decodeError adds the line and column to JSON syntax errors
+// and the JSON path to type errors.
+func decodeError(b []byte, err error) error {
+	var syntaxErr *json.SyntaxError
+	if errors.As(err, &syntaxErr) {
+		// the offset is after the invalid character
+		offset := int(syntaxErr.Offset) - 1
+		if offset < 0 {
+			offset = 0
+		}
+		line := bytes.Count(b[:offset], []byte("\n")) + 1
+		column := offset - bytes.LastIndexByte(b[:offset], '\n')
+		return fmt.Errorf("line %d column %d: %w", line, column, err)
+	}
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) && typeErr.Field != "" {
+		return fmt.Errorf("$.%s: expected %s, got %s", typeErr.Field, typeErr.Type, typeErr.Value)
+	}
+	return err
+}
+
+// configError lists all problems of the config.
+type configError struct {
+	problems []string // prefixed with the JSON path
+}
+
+func (e *configError) Error() string {
+	return "invalid config:\n\t" + strings.Join(e.problems, "\n\t")
+}
+
+func (e *configError) addf(path, format string, args ...interface{}) {
+	e.problems = append(e.problems, "$."+path+": "+fmt.Sprintf(format, args...))
+}
+
+func (c *config) validate() error {
+	e := &configError{}
+
+	for _, required := range []struct{ path, value string }{
+		{"Address", c.Address},
+		{"Username", c.Username},
+		{"Database", c.Database},
+	} {
+		if required.value == "" {
+			e.addf(required.path, "required")
+		}
+	}
+
+	if len(c.SQLFiles) == 0 {
+		e.addf("SQLFiles", "at least one file, directory or pattern is required")
+	}
+	for i, entry := range c.SQLFiles {
+		path := fmt.Sprintf("SQLFiles[%d]", i)
+		switch {
+		case entry == "":
+			e.addf(path, "empty path")
+		case isGlobPattern(entry):
+			if err := checkGlob(filepath.ToSlash(entry)); err != nil {
+				e.addf(path, "invalid pattern %q: %v", entry, err)
+			} else if _, err := findSQLFiles([]string{entry}, nil); err != nil {
+				e.addf(path, "pattern %q matches no files", entry)
+			}
+		default:
+			if _, err := os.Stat(entry); err != nil {
+				e.addf(path, "%v", err)
+			}
+		}
+	}
+	for i, pattern := range c.ExcludeSQLFiles {
+		if err := checkGlob(filepath.ToSlash(pattern)); err != nil {
+			e.addf(fmt.Sprintf("ExcludeSQLFiles[%d]", i), "invalid pattern %q: %v", pattern, err)
+		}
+	}
+
+	if _, err := parseEncoding(c.Encoding); err != nil {
+		e.addf("Encoding", "%v, expected utf-8, latin1 or windows-1252", err)
+	}
+	checkOutput(e, "", c.Output, c.Package)
+	for i, f := range c.Files {
+		path := fmt.Sprintf("Files[%d].", i)
+		if f.Pattern == "" {
+			e.addf(path+"Pattern", "required")
+		} else if err := checkGlob(filepath.ToSlash(f.Pattern)); err != nil {
+			e.addf(path+"Pattern", "invalid pattern %q: %v", f.Pattern, err)
+		}
+		checkOutput(e, path, f.Output, f.Package)
+		for j, importPath := range f.Imports {
+			if importPath == "" || strings.ContainsAny(importPath, "\" \t") {
+				e.addf(fmt.Sprintf("%sImports[%d]", path, j), "invalid package path %q", importPath)
+			}
+		}
+	}
+
+	if _, err := parseNullableStrategy(c.Nullable); err != nil {
+		e.addf("Nullable", "%v, expected pointer, null or sql", err)
+	}
+	for i, schema := range c.Tables {
+		if schema == "" {
+			e.addf(fmt.Sprintf("Tables[%d]", i), "empty schema name")
+		}
+	}
+
+	names := make([]string, 0, len(c.Types))
+	for name := range c.Types {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	packages := make(map[string][]string) // package path -> JSON paths
+	for _, name := range names {
+		info := c.Types[name]
+		path := fmt.Sprintf("Types[%q]", name)
+		if name == "" {
+			e.addf(path, "empty type name")
+		}
+		if !goTypeMatcher.MatchString(info.Go) {
+			e.addf(path+".Go", "invalid Go type %q, expected e.g. int64 or []*math/big.Rat", info.Go)
+		} else if importPath := goTypePackage(info.Go); importPath != "" {
+			packages[importPath] = append(packages[importPath], path+".Go")
+		}
+		if _, err := parseNullableStrategy(info.Nullable); err != nil {
+			e.addf(path+".Nullable", "%v, expected pointer, null or sql", err)
+		}
+	}
+	checkPackages(e, goCommandDir(c.Output), packages)
+
+	if len(e.problems) > 0 {
+		return e
+	}
+	return nil
+}
+
+func checkOutput(e *configError, path, output, pkg string) {
+	if output != "" && filepath.Ext(output) != ".go" {
+		e.addf(path+"Output", "%q is not a .go file", output)
+	}
+	if pkg != "" && !token.IsIdentifier(pkg) {
+		e.addf(path+"Package", "%q is not a valid package name", pkg)
+	}
+}
+
+// goTypePackage returns the package path of a Go type
+// in the format of TypeInfo.Go, e.g. math/big for []*math/big.Rat.
+func goTypePackage(goType string) string {
+	typ := strings.TrimLeft(goType, "[]*0123456789")
+	dot := strings.LastIndexByte(typ, '.')
+	if dot < 0 {
+		return ""
+	}
+	return typ[:dot]
+}
+
+// checkPackages reports package paths which can not be imported
+// by the module of the output file.
+func checkPackages(e *configError, dir string, packages map[string][]string) {
+	if len(packages) == 0 {
+		return
+	}
+	paths := make([]string, 0, len(packages))
+	for importPath := range packages {
+		paths = append(paths, importPath)
+	}
+	sort.Strings(paths)
+
+	args := append([]string{"list", "-e", "-json=ImportPath,Error"}, paths...)
+	cmd := exec.Command("go", args...)
+	cmd.Dir = dir
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		e.addf("Types", "checking the Go packages with go list: %v: %s", err, bytes.TrimSpace(stderr.Bytes()))
+		return
+	}
+
+	failed := make(map[string]string)
+	dec := json.NewDecoder(bytes.NewReader(out))
+	for {
+		var listed struct {
+			ImportPath string
+			Error      *struct{ Err string }
+		}
+		if err := dec.Decode(&listed); err == io.EOF {
+			break
+		} else if err != nil {
+			e.addf("Types", "checking the Go packages with go list: %v", err)
+			return
+		}
+		if listed.Error != nil {
+			failed[listed.ImportPath] = listed.Error.Err
+		}
+	}
+	for _, importPath := range paths {
+		if msg, ok := failed[importPath]; ok {
+			for _, path := range packages[importPath] {
+				e.addf(path, "package %s can not be imported: %s", importPath, msg)
+			}
+		}
+	}
+}
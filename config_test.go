@@ -0,0 +1,171 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLoadConfigFormats(t *testing.T) {
+	dir := t.TempDir()
+	sqlFile := filepath.Join(dir, "queries.sql")
+	if err := os.WriteFile(sqlFile, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	output := filepath.Join(dir, "queries.gen.go")
+	files := map[string]string{
+		"config.json": `{
+			"$schema": "config.schema.json",
+			"Address": ":5432", "Username": "u", "Database": "d",
+			"SQLFiles": [` + jsonQuote(sqlFile) + `],
+			"Output": ` + jsonQuote(output) + `, "Package": "queries",
+			"Types": {"numeric": "*math/big.Rat", "text": {"Go": "string", "Nullable": "sql"}}
+		}`,
+		"config.yaml": `
+Address: ":5432"
+Username: u
+Database: d
+SQLFiles: [` + jsonQuote(sqlFile) + `]
+Output: ` + jsonQuote(output) + `
+Package: queries
+Types:
+  numeric: "*math/big.Rat"
+  text: {Go: string, Nullable: sql}
+`,
+		"config.toml": `
+Address = ":5432"
+Username = "u"
+Database = "d"
+SQLFiles = [` + jsonQuote(sqlFile) + `]
+Output = ` + jsonQuote(output) + `
+Package = "queries"
+
+[Types]
+numeric = "*math/big.Rat"
+text = {Go = "string", Nullable = "sql"}
+`,
+	}
+	var configs []*config
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		c, err := loadConfig(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.Schema = ""
+		configs = append(configs, c)
+	}
+	if configs[0].Types["numeric"].Go != "*math/big.Rat" || configs[0].Types["text"].Nullable != "sql" {
+		t.Fatalf("got %+v", configs[0])
+	}
+	for _, c := range configs[1:] {
+		if !reflect.DeepEqual(c, configs[0]) {
+			t.Fatalf("got %+v, expected %+v", c, configs[0])
+		}
+	}
+
+	path := filepath.Join(dir, "syntax.json")
+	if err := os.WriteFile(path, []byte("{\n  \"Address\": ,\n}"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadConfig(path); err == nil || !strings.Contains(err.Error(), "line 2 column 14") {
+		t.Fatalf("got %v", err)
+	}
+}
+
+func jsonQuote(s string) string {
+	b, _ := json.Marshal(s)
+	return string(b)
+}
+
+func TestValidateConfig(t *testing.T) {
+	dir := t.TempDir()
+	c := &config{
+		Username:        "u",
+		SQLFiles:        []string{filepath.Join(dir, "missing.sql"), filepath.Join(dir, "*.sql"), ""},
+		ExcludeSQLFiles: []string{"["},
+		Encoding:        "ebcdic",
+		Output:          filepath.Join(dir, "queries.go.txt"),
+		Package:         "my-queries",
+		Files:           []FileConfig{{Output: "x.go", Package: "x"}},
+		Nullable:        "maybe",
+		Types: map[string]TypeInfo{
+			"numeric": {Go: "*math/big.Rat"},
+			"citext":  {Go: "map[string]string"},
+			"uuid":    {Go: "example.invalid/nope.UUID", Nullable: "never"},
+		},
+	}
+	err := c.validate()
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	for _, expected := range []string{
+		"$.Address: required",
+		"$.Database: required",
+		"$.SQLFiles[0]: ",
+		"$.SQLFiles[1]: pattern",
+		"$.SQLFiles[2]: empty path",
+		"$.ExcludeSQLFiles[0]: invalid pattern",
+		"$.Encoding: unknown encoding",
+		"$.Output: ",
+		"$.Package: ",
+		"$.Files[0].Pattern: required",
+		"$.Nullable: unknown nullable strategy",
+		`$.Types["citext"].Go: invalid Go type`,
+		`$.Types["uuid"].Go: package example.invalid/nope can not be imported`,
+		`$.Types["uuid"].Nullable: `,
+	} {
+		if !strings.Contains(err.Error(), "\t"+expected) {
+			t.Fatalf("missing %q in:\n%v", expected, err)
+		}
+	}
+	if strings.Contains(err.Error(), "numeric") {
+		t.Fatalf("unexpected problem with numeric in:\n%v", err)
+	}
+}
+
+func TestConfigSchema(t *testing.T) {
+	b, err := os.ReadFile("config.schema.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	type object struct {
+		Properties map[string]json.RawMessage
+	}
+	var schema struct {
+		object
+		Definitions map[string]json.RawMessage
+	}
+	if err := json.Unmarshal(b, &schema); err != nil {
+		t.Fatal(err)
+	}
+	var files struct {
+		Items object
+	}
+	if err := json.Unmarshal(schema.Properties["Files"], &files); err != nil {
+		t.Fatal(err)
+	}
+
+	check := func(typ reflect.Type, properties map[string]json.RawMessage) {
+		for i := 0; i < typ.NumField(); i++ {
+			name := typ.Field(i).Name
+			if tag := typ.Field(i).Tag.Get("json"); tag != "" {
+				name = tag
+			}
+			if _, ok := properties[name]; !ok {
+				t.Fatalf("%s.%s is missing in config.schema.json", typ.Name(), name)
+			}
+		}
+		if len(properties) != typ.NumField() {
+			t.Fatalf("%s: config.schema.json has %d properties, expected %d", typ.Name(), len(properties), typ.NumField())
+		}
+	}
+	check(reflect.TypeOf(config{}), schema.Properties)
+	check(reflect.TypeOf(FileConfig{}), files.Items.Properties)
+}
@@ -3,9 +3,12 @@ package main
 import (
 	"bytes"
 	"errors"
+	"fmt"
 	"regexp"
 	"strconv"
 	"strings"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/erikfastermann/sql/util"
 )
@@ -71,6 +74,7 @@ type declaration struct {
 	// blank line or last line with data
 	endLineIndex int // inclusive
 	header       []byte
+	headerOffset int // characters before the header in its line
 
 	// the following fields are set by calling parse
 
@@ -78,11 +82,17 @@ type declaration struct {
 	resultCount             resultCount
 	resultStructHasFuncName bool
 
-	funcName      []byte // might be empty if resultKind == resultStruct
-	structName    []byte // only set if resultKind == resultStruct
-	columnOptions []columnOption
-
-	body []byte
+	funcName         []byte // might be empty if resultKind == resultStruct
+	structName       []byte // only set if resultKind == resultStruct
+	inputStruct      []byte // optional, name or Go type
+	nested           bool   // group the result columns by table
+	parameterOptions []parameterOption
+	columnOptions    []columnOption
+
+	doc         []string // leading line comments of the body, without --
+	body        []byte
+	bodyOffset  int         // byte offset of the body in the file
+	bodyOffsets bodyOffsets // set if named parameters were rewritten
 }
 
 func (d *declaration) String() string {
@@ -105,6 +115,31 @@ func (d *declaration) String() string {
 	b.WriteString(d.resultCount.String())
 	b.WriteString("))")
 
+	if len(d.inputStruct) != 0 {
+		b.WriteString(" <- ")
+		b.Write(d.inputStruct)
+	}
+
+	if len(d.parameterOptions) > 0 {
+		b.WriteString(" (")
+	}
+	for i, opt := range d.parameterOptions {
+		if opt.index > 0 {
+			b.WriteByte('$')
+			b.WriteString(strconv.Itoa(opt.index))
+		} else {
+			b.Write(opt.name)
+		}
+		b.WriteString(": ")
+		opt.typeOption.write(&b)
+		if i != len(d.parameterOptions)-1 {
+			b.WriteString(", ")
+		}
+	}
+	if len(d.parameterOptions) > 0 {
+		b.WriteString(")")
+	}
+
 	if len(d.columnOptions) > 0 {
 		b.WriteString(" [")
 	}
@@ -114,9 +149,8 @@ func (d *declaration) String() string {
 		} else {
 			b.Write(opt.name)
 		}
-		b.WriteString(": (notnull? ")
-		b.WriteString(strconv.FormatBool(opt.notNull))
-		b.WriteByte(')')
+		b.WriteString(": ")
+		opt.typeOption.write(&b)
 		if i != len(d.columnOptions)-1 {
 			b.WriteString(", ")
 		}
@@ -125,40 +159,101 @@ func (d *declaration) String() string {
 		b.WriteString("]")
 	}
 
+	if d.nested {
+		b.WriteString(" nested")
+	}
+
 	b.WriteByte('\n')
 	b.Write(d.body)
 
 	return b.String()
 }
 
-var errEmptyBody = errors.New("body of declared block is empty")
+var (
+	errEmptyBody          = errors.New("body of declared block is empty")
+	errMultipleStatements = errors.New("only a single statement is allowed in a declaration")
+)
+
+// bodyError reports the position of an error in the body.
+type bodyError struct {
+	offset int // byte offset in the file
+	err    error
+}
+
+func (e *bodyError) Error() string {
+	return e.err.Error()
+}
+
+func (e *bodyError) Unwrap() error {
+	return e.err
+}
 
 func (d *declaration) parse(h *parser) error {
 	if err := d.parseHeader(); err != nil {
+		var headerErr *headerError
+		if errors.As(err, &headerErr) {
+			return fmt.Errorf("column %d: %w", d.headerPosition(headerErr.offset)+1, err)
+		}
 		return err
 	}
 	if d.startLineIndex+1 >= d.endLineIndex {
 		return errEmptyBody
 	}
-	d.body = bytes.TrimSpace(h.lineSlice(d.startLineIndex+1, d.endLineIndex))
-	if bytes.HasSuffix(d.body, []byte(";")) {
-		// TODO: does not work with trailing comments
-		d.body = d.body[:len(d.body)-1]
+	from, _ := h.lineAtRange(d.startLineIndex + 1)
+	_, to := h.lineAtRange(d.endLineIndex)
+	block := h.b.Bytes()[from:to]
+	tokens, err := lexSQL(block)
+	if err != nil {
+		var lexErr *lexError
+		if errors.As(err, &lexErr) {
+			return &bodyError{offset: from + lexErr.offset, err: err}
+		}
+		return err
 	}
+
+	// Leading and trailing comments and the semicolon are removed,
+	// comments inside the statement are kept.
+	// Leading line comments are the documentation.
+	d.doc = nil
+	start, end := -1, -1
+	inDoc, terminated := true, false
+	for _, tok := range tokens {
+		if tok.kind == sqlComment {
+			text := tok.text(block)
+			inDoc = inDoc && bytes.HasPrefix(text, []byte("--"))
+			if inDoc {
+				line := bytes.TrimPrefix(text[2:], []byte(" "))
+				d.doc = append(d.doc, string(bytes.TrimRightFunc(line, unicode.IsSpace)))
+			}
+			continue
+		}
+		inDoc = false
+		if tok.kind == sqlPunctuation && block[tok.start] == ';' {
+			terminated = true
+			continue
+		}
+		if terminated {
+			return &bodyError{offset: from + tok.start, err: errMultipleStatements}
+		}
+		if start < 0 {
+			start = tok.start
+		}
+		end = tok.end
+	}
+	if start < 0 {
+		return errEmptyBody
+	}
+	d.body = block[start:end]
+	d.bodyOffset = from + start
 	return nil
 }
 
-const (
-	regexpIdentifier          = `(\pL+[\pL\pN]*)`
-	regexpIdentifierWithEdges = `(([#!]?)` + regexpIdentifier + `([\?\+]?))`
-	regexpTwoNames            = "(" + regexpIdentifier + " -> " + regexpIdentifierWithEdges + ")"
-	regexpHeader              = "^(" + regexpTwoNames + "|" + regexpIdentifierWithEdges + `)( \{(.*?)\})?$`
-)
+// same format as TypeInfo.Go, e.g. []*math/big.Rat
+const regexpGoType = `^(\[\]|\[[0-9]+\]|\*)*([\pL\pN_./-]+\.)?[\pL_][\pL\pN_]*$`
 
-var headerMatcher = regexp.MustCompile(regexpHeader)
+var goTypeMatcher = regexp.MustCompile(regexpGoType)
 
 var (
-	errInvalidHeader        = errors.New("declaration header is invalid") // TODO: nicer error
 	errResultNoneWithOption = errors.New(
 		"specified result kind as none with `!`, but used `?` (optional)",
 	)
@@ -174,63 +269,60 @@ var (
 	errResultNoneWithColumnOptions = errors.New(
 		"column options not allowed with result kind none (`!`)",
 	)
-)
-
-func (d *declaration) parseHeader() error {
-	// TODO: real parser
-
-	const (
-		reTwoNames             = 2
-		reTwoNamesFuncName     = 3
-		reTwoNamesEdgesStart   = 4
-		reSingleNameEdgesStart = 8
-		reColumnOptions        = 13
-		reMatchLength          = 14
+	errNestedWithoutStruct = errors.New(
+		"nested is only allowed if the result is a struct",
+	)
+	errInvalidInputStruct = errors.New(
+		"input struct (`<-`) must be a name or a Go type like example.com/person.New",
 	)
-	const (
-		rePrefixOffset = 1
-		reNameOffset   = 2
-		reSuffixOffset = 3
+	errGoTypeNotAllowed = errors.New(
+		"existing Go types are only allowed as the struct after `->`",
 	)
+	errColumnIndexTooLarge = errors.New("column index is too large")
+	errColumnIndexTooSmall = errors.New("column index is too small (less than 1)")
+)
 
-	match := headerMatcher.FindSubmatch(d.header)
-	if len(match) == 0 {
-		return errInvalidHeader
-	}
-	if len(match) != reMatchLength {
-		panic("internal error")
-	}
+// errorAt returns a headerError at the offset which wraps err.
+func errorAt(offset int, err error) error {
+	return &headerError{offset: offset, msg: "invalid header", err: err}
+}
 
-	edgesStart := reSingleNameEdgesStart
-	hasTwoNames := match[reTwoNames] != nil
-	if hasTwoNames {
-		edgesStart = reTwoNamesEdgesStart
-	}
+// headerPosition converts a byte offset in the header
+// to the number of characters before it in the line.
+func (d *declaration) headerPosition(offset int) int {
+	return d.headerOffset + utf8.RuneCount(d.header[:offset])
+}
 
-	prefix := match[edgesStart+rePrefixOffset]
-	name := match[edgesStart+reNameOffset]
-	suffix := match[edgesStart+reSuffixOffset]
+func (d *declaration) parseHeader() error {
+	ast, err := parseHeaderAST(string(d.header))
+	if err != nil {
+		return err
+	}
 
-	switch string(prefix) {
+	name := []byte(ast.name.text)
+	if isGoTypeReference(ast.name.text) && (ast.funcName == nil || ast.prefix != "") {
+		return errorAt(ast.name.offset, errGoTypeNotAllowed)
+	}
+	switch ast.prefix {
 	case "!":
-		if hasTwoNames {
-			return errResultNoneWithTwoNames
+		if ast.funcName != nil {
+			return errorAt(ast.funcName.offset, errResultNoneWithTwoNames)
 		}
 		d.resultKind = resultNone
 		d.funcName = name
 	case "":
 		d.resultKind = resultStruct
-		if hasTwoNames {
+		if ast.funcName != nil {
 			d.resultStructHasFuncName = true
-			d.funcName = match[reTwoNamesFuncName]
+			d.funcName = []byte(ast.funcName.text)
 			d.structName = name
 		} else {
 			d.resultStructHasFuncName = false
 			d.structName = name
 		}
 	case "#":
-		if hasTwoNames {
-			return errResultDirectWithTwoNames
+		if ast.funcName != nil {
+			return errorAt(ast.funcName.offset, errResultDirectWithTwoNames)
 		}
 		d.resultKind = resultDirect
 		d.funcName = name
@@ -238,10 +330,10 @@ func (d *declaration) parseHeader() error {
 		panic("unreachable")
 	}
 
-	switch string(suffix) {
+	switch ast.suffix {
 	case "?":
 		if d.resultKind == resultNone {
-			return errResultNoneWithOption
+			return errorAt(ast.name.offset+len(ast.name.text), errResultNoneWithOption)
 		}
 		d.resultCount = resultOption
 	case "":
@@ -250,86 +342,134 @@ func (d *declaration) parseHeader() error {
 		}
 	case "+":
 		if d.resultKind == resultNone {
-			return errResultNoneWithMany
+			return errorAt(ast.name.offset+len(ast.name.text), errResultNoneWithMany)
 		}
 		d.resultCount = resultMany
 	default:
 		panic("unreachable")
 	}
 
-	columnOptionsRaw := match[reColumnOptions]
-	if columnOptionsRaw != nil {
-		if err := d.parseColumnOptions(columnOptionsRaw); err != nil {
+	if ast.funcName != nil {
+		if err := checkDeclaredName(ast.funcName.text); err != nil {
+			return errorAt(ast.funcName.offset, err)
+		}
+	}
+	if !isGoTypeReference(ast.name.text) {
+		if err := checkDeclaredName(ast.name.text); err != nil {
+			return errorAt(ast.name.offset, err)
+		}
+	}
+
+	if ast.input != nil {
+		if strings.ContainsAny(ast.input.text[:1], "[*") {
+			return errorAt(ast.input.offset, errInvalidInputStruct)
+		}
+		if !isGoTypeReference(ast.input.text) {
+			if err := checkDeclaredName(ast.input.text); err != nil {
+				return errorAt(ast.input.offset, err)
+			}
+		}
+		d.inputStruct = []byte(ast.input.text)
+	}
+
+	for _, opt := range ast.parameters {
+		index, name, err := optionKey(opt)
+		if err != nil {
+			return err
+		}
+		d.parameterOptions = append(d.parameterOptions, parameterOption{
+			index:      index,
+			name:       name,
+			typeOption: newTypeOption(opt),
+		})
+	}
+
+	if d.resultKind == resultNone && len(ast.columns) != 0 {
+		return errorAt(ast.columns[0].key.offset, errResultNoneWithColumnOptions)
+	}
+	for _, opt := range ast.columns {
+		index, name, err := optionKey(opt)
+		if err != nil {
 			return err
 		}
+		d.columnOptions = append(d.columnOptions, columnOption{
+			index:      index,
+			name:       name,
+			typeOption: newTypeOption(opt),
+		})
 	}
 
-	if d.resultKind == resultNone && len(d.columnOptions) != 0 {
-		return errResultNoneWithColumnOptions
+	d.nested = ast.nested
+	if d.nested && d.resultKind != resultStruct {
+		return errorAt(len(d.header)-len("nested"), errNestedWithoutStruct)
 	}
 
 	return nil
 }
 
-var (
-	errColumnIndexTooLarge = errors.New("column index is too large")
-	errColumnIndexTooSmall = errors.New("column index is too small (less than 1)")
-)
+func optionKey(opt headerOption) (index int, name []byte, err error) {
+	if !opt.keyIsIndex {
+		return 0, []byte(opt.key.text), nil
+	}
+	index64, err := util.ParseInt64([]byte(opt.key.text))
+	if err != nil {
+		if errors.Is(err, util.ErrOverflow) {
+			return 0, nil, errorAt(opt.key.offset, errColumnIndexTooLarge)
+		}
+		panic("internal error")
+	}
+	index, err = util.SafeConvert[int64, int](index64)
+	if err != nil {
+		return 0, nil, errorAt(opt.key.offset, errColumnIndexTooLarge)
+	}
+	if index < 1 {
+		return 0, nil, errorAt(opt.key.offset, errColumnIndexTooSmall)
+	}
+	return index, nil, nil
+}
 
-func (d *declaration) parseColumnOptions(columnOptionsRaw []byte) error {
-	// TODO: better error messages
-	// TODO: better parsing than string splitting
+func newTypeOption(opt headerOption) typeOption {
+	var typeOpt typeOption
+	switch opt.nullability {
+	case "null":
+		typeOpt.notNull, typeOpt.hasNullability = false, true
+	case "notnull":
+		typeOpt.notNull, typeOpt.hasNullability = true, true
+	}
+	if opt.goType != nil {
+		typeOpt.goType = []byte(opt.goType.text)
+	}
+	return typeOpt
+}
 
-	columnOptionsSplittedRaw := bytes.Split(columnOptionsRaw, []byte(","))
-	for _, columnOptionRaw := range columnOptionsSplittedRaw {
-		columnOptionPairRaw := bytes.Split(columnOptionRaw, []byte(":"))
-		if len(columnOptionPairRaw) != 2 {
-			return errInvalidHeader
-		}
-		specRaw := bytes.TrimSpace(columnOptionPairRaw[0])
-		nullableRaw := bytes.TrimSpace(columnOptionPairRaw[1])
-
-		var notNull bool
-		switch string(nullableRaw) {
-		case "null":
-			notNull = false
-		case "notnull":
-			notNull = true
-		default:
-			return errInvalidHeader
-		}
+type typeOption struct {
+	notNull        bool
+	hasNullability bool
+	goType         []byte // optional
+}
 
-		indexOrNameRaw := bytes.TrimSpace(specRaw)
-		index64, err := util.ParseInt64(indexOrNameRaw)
-		if err != nil {
-			if errors.Is(err, util.ErrOverflow) {
-				return errColumnIndexTooLarge
-			}
-			d.columnOptions = append(d.columnOptions, columnOption{
-				index:   0,
-				name:    indexOrNameRaw,
-				notNull: notNull,
-			})
-		} else {
-			index, err := util.SafeConvert[int64, int](index64)
-			if err != nil {
-				return errColumnIndexTooLarge
-			}
-			if index < 1 {
-				return errColumnIndexTooSmall
-			}
-			d.columnOptions = append(d.columnOptions, columnOption{
-				index:   index,
-				notNull: notNull,
-			})
-		}
+func (opt typeOption) write(b *strings.Builder) {
+	b.WriteString("(notnull? ")
+	if opt.hasNullability {
+		b.WriteString(strconv.FormatBool(opt.notNull))
+	} else {
+		b.WriteString("unset")
 	}
+	if len(opt.goType) != 0 {
+		b.WriteString(", type ")
+		b.Write(opt.goType)
+	}
+	b.WriteByte(')')
+}
 
-	return nil
+type parameterOption struct {
+	index int    // starts at 1, use names if == 0
+	name  []byte // parameter name
+	typeOption
 }
 
 type columnOption struct {
-	index   int    // starts at 1, use names if == 0
-	name    []byte // column or field name
-	notNull bool
+	index int    // starts at 1, use names if == 0
+	name  []byte // column or field name
+	typeOption
 }
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestParseHeaderOptions(t *testing.T) {
+	d := declaration{header: []byte(
+		"GetPerson -> Person ($1: person.ID, $2: []byte, name: null) {id: person.ID, 2: notnull, created: null time.Time}",
+	)}
+	if err := d.parseHeader(); err != nil {
+		t.Fatal(err)
+	}
+	if len(d.parameterOptions) != 3 ||
+		d.parameterOptions[0].index != 1 ||
+		string(d.parameterOptions[0].goType) != "person.ID" ||
+		string(d.parameterOptions[1].goType) != "[]byte" ||
+		string(d.parameterOptions[2].name) != "name" ||
+		!d.parameterOptions[2].hasNullability ||
+		d.parameterOptions[2].notNull {
+		t.Fatalf("parameter options: got %+v", d.parameterOptions)
+	}
+	expected := []columnOption{
+		{name: []byte("id"), typeOption: typeOption{goType: []byte("person.ID")}},
+		{index: 2, typeOption: typeOption{notNull: true, hasNullability: true}},
+		{name: []byte("created"), typeOption: typeOption{hasNullability: true, goType: []byte("time.Time")}},
+	}
+	if len(d.columnOptions) != len(expected) {
+		t.Fatalf("column options: got %+v", d.columnOptions)
+	}
+	for i, opt := range d.columnOptions {
+		e := expected[i]
+		if opt.index != e.index ||
+			string(opt.name) != string(e.name) ||
+			opt.notNull != e.notNull ||
+			opt.hasNullability != e.hasNullability ||
+			string(opt.goType) != string(e.goType) {
+			t.Fatalf("column option %d: got %+v", i, opt)
+		}
+	}
+
+	d = declaration{header: []byte("!InsertPerson <- example.com/person.New (name: null)")}
+	if err := d.parseHeader(); err != nil {
+		t.Fatal(err)
+	}
+	if string(d.inputStruct) != "example.com/person.New" || len(d.parameterOptions) != 1 {
+		t.Fatalf("input struct: got %q, %+v", d.inputStruct, d.parameterOptions)
+	}
+
+	d = declaration{header: []byte("GetNames -> Names+ {1: notnull} nested")}
+	if err := d.parseHeader(); err != nil {
+		t.Fatal(err)
+	}
+	if !d.nested {
+		t.Fatal("expected nested")
+	}
+
+	d = declaration{header: []byte("GetUser -> example.com/app/models.User?")}
+	if err := d.parseHeader(); err != nil {
+		t.Fatal(err)
+	}
+	if string(d.structName) != "example.com/app/models.User" || d.resultCount != resultOption {
+		t.Fatalf("existing struct: got %q (%s)", d.structName, d.resultCount)
+	}
+
+	for _, invalid := range []string{
+		"GetPerson -> Person ($0: int)",
+		"GetPerson -> Person ($: int)",
+		"GetPerson -> Person (a b: int)",
+		"GetPerson -> Person ($1: not a type)",
+		"GetPerson -> Person {id: notnull int64 extra}",
+		"GetPerson -> Person {id: map[int]int}",
+		"!InsertPerson <- *NewPerson",
+		"#GetName nested",
+		"example.com/app/models.User",
+		"GetPerson -> string",
+		"!type",
+		"!Insert <- error",
+	} {
+		d := declaration{header: []byte(invalid)}
+		if err := d.parseHeader(); err == nil {
+			t.Fatalf("%q: expected error", invalid)
+		}
+	}
+}
+
+func TestParseBody(t *testing.T) {
+	tests := []struct {
+		input    string
+		body     string
+		doc      string
+		errorAt  string // the error position starts with errorAt
+		expected error
+	}{
+		{"--- !Insert\nselect 1;\n", "select 1", "", "", nil},
+		{"--- !Insert\n-- leading\n  select 1 -- inside\n  from t; -- note\n/* trailing */\n", "select 1 -- inside\n  from t", "leading", "", nil},
+		{"--- !Insert\n-- Insert adds.\n--\n--  More.  \n/* no doc */ -- no doc\nselect 1\n", "select 1", "Insert adds.\n\n More.", "", nil},
+		{"--- !Insert\nselect ';' as a, $$;$$ as b;;\n", "select ';' as a, $$;$$ as b", "", "", nil},
+		{"--- !Insert\n-- only a comment;\n", "", "", "", errEmptyBody},
+		{"--- !Insert\nselect 1; select 2;\n", "", "", "select 2", errMultipleStatements},
+	}
+	for _, tt := range tests {
+		var p parser
+		p.b.WriteString(tt.input)
+		p.calculateNewlineOffsets()
+		if err := p.buildRawDeclarations(); err != nil {
+			t.Fatal(err)
+		}
+		d := &p.declarations[0]
+		err := d.parse(&p)
+		if !errors.Is(err, tt.expected) {
+			t.Fatalf("%q: got error %v, expected %v", tt.input, err, tt.expected)
+		}
+		if tt.errorAt != "" {
+			var bodyErr *bodyError
+			if !errors.As(err, &bodyErr) || !strings.HasPrefix(tt.input[bodyErr.offset:], tt.errorAt) {
+				t.Fatalf("%q: wrong error position %v", tt.input, err)
+			}
+		}
+		if err == nil && string(d.body) != tt.body {
+			t.Fatalf("%q: got body %q, expected %q", tt.input, d.body, tt.body)
+		}
+		if err == nil && strings.Join(d.doc, "\n") != tt.doc {
+			t.Fatalf("%q: got doc %q, expected %q", tt.input, d.doc, tt.doc)
+		}
+		if err == nil && tt.input[d.bodyOffset:d.bodyOffset+len(d.body)] != tt.body {
+			t.Fatalf("%q: wrong body offset %d", tt.input, d.bodyOffset)
+		}
+	}
+}
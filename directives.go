@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"go/token"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// A SQL file can start with directives, before any declaration:
+//
+//	--! package person
+//	--! output person/queries.gen.go
+//	--! import "example.com/app/person"
+//	--! import p "example.com/app/person"
+//
+// Imported packages can be referenced by name in the Go types
+// of the headers (e.g. {id: person.ID}). Directives override
+// the matching entry of config.Files, which overrides the config.
+
+const directiveStartComment = "--!"
+
+type fileDirectives struct {
+	pkg     string
+	output  string
+	imports map[string]string // name -> path
+}
+
+func (d *fileDirectives) addImport(name, importPath string) error {
+	if name == "" {
+		name = path.Base(importPath)
+	}
+	if !token.IsIdentifier(name) {
+		return fmt.Errorf("import %q: %w", importPath, errInvalidIdentifier)
+	}
+	if existing, ok := d.imports[name]; ok && existing != importPath {
+		return fmt.Errorf("import %q: %s is already imported from %q", importPath, name, existing)
+	}
+	if d.imports == nil {
+		d.imports = make(map[string]string)
+	}
+	d.imports[name] = importPath
+	return nil
+}
+
+// parseDirectives reads the directives at the start of the file,
+// only blank lines and line comments can come before them.
+func (p *parser) parseDirectives() error {
+	p.directives = fileDirectives{}
+	for lineIndex := 0; lineIndex < p.lineCount(); lineIndex++ {
+		line := bytes.TrimSpace(p.lineAt(lineIndex))
+		if bytes.HasPrefix(line, []byte(headerStartComment)) {
+			return nil
+		}
+		if !bytes.HasPrefix(line, []byte(directiveStartComment)) {
+			if len(line) == 0 || bytes.HasPrefix(line, []byte("--")) {
+				continue
+			}
+			return nil
+		}
+		if err := p.directives.parse(string(line[len(directiveStartComment):])); err != nil {
+			return &parserError{line: lineIndex + 1, msg: err.Error()}
+		}
+	}
+	return nil
+}
+
+func (d *fileDirectives) parse(directive string) error {
+	fields := strings.Fields(directive)
+	if len(fields) == 0 {
+		return errors.New("empty directive")
+	}
+	switch key, args := fields[0], fields[1:]; key {
+	case "package":
+		if len(args) != 1 || !token.IsIdentifier(args[0]) {
+			return errors.New("expected `--! package name`")
+		}
+		if d.pkg != "" {
+			return errors.New("package is set multiple times")
+		}
+		d.pkg = args[0]
+	case "output":
+		if len(args) != 1 {
+			return errors.New("expected `--! output path`")
+		}
+		if d.output != "" {
+			return errors.New("output is set multiple times")
+		}
+		d.output = filepath.FromSlash(args[0])
+	case "import":
+		var name, quoted string
+		switch len(args) {
+		case 1:
+			quoted = args[0]
+		case 2:
+			name, quoted = args[0], args[1]
+		default:
+			return errors.New("expected `--! import [name] \"path\"`")
+		}
+		importPath, err := strconv.Unquote(quoted)
+		if err != nil || importPath == "" {
+			return fmt.Errorf("import path %s must be a quoted string", quoted)
+		}
+		return d.addImport(name, importPath)
+	default:
+		return fmt.Errorf("unknown directive %q", key)
+	}
+	return nil
+}
+
+// fileDirectives combines the directives of the file with
+// the first matching entry of config.Files and the config.
+func (b *builder) fileDirectives(sqlFile string) (fileDirectives, error) {
+	d := b.parser.directives
+	for _, f := range b.config.Files {
+		matched, err := matchGlob(filepath.ToSlash(f.Pattern), filepath.ToSlash(sqlFile))
+		if err != nil {
+			return d, fmt.Errorf("config.Files pattern %q: %w", f.Pattern, err)
+		}
+		if !matched {
+			continue
+		}
+		if d.pkg == "" {
+			d.pkg = f.Package
+		}
+		if d.output == "" {
+			d.output = f.Output
+		}
+		for _, importPath := range f.Imports {
+			if _, ok := d.imports[path.Base(importPath)]; ok {
+				// imports of the file take precedence
+				continue
+			}
+			if err := d.addImport("", importPath); err != nil {
+				return d, err
+			}
+		}
+		break
+	}
+	if d.pkg == "" {
+		d.pkg = b.config.Package
+	}
+	if d.output == "" {
+		d.output = b.config.Output
+	}
+	if d.output != "" && b.outputDir != "" && !filepath.IsAbs(d.output) {
+		d.output = filepath.Join(b.outputDir, d.output)
+	}
+	return d, nil
+}
+
+// resolveImports replaces the package names of imported packages
+// in the Go types of the header with the import path.
+func (d *declaration) resolveImports(imports map[string]string) {
+	if len(imports) == 0 {
+		return
+	}
+	for i := range d.parameterOptions {
+		d.parameterOptions[i].goType = resolveImport(d.parameterOptions[i].goType, imports)
+	}
+	for i := range d.columnOptions {
+		d.columnOptions[i].goType = resolveImport(d.columnOptions[i].goType, imports)
+	}
+	if d.resultKind == resultStruct {
+		d.structName = resolveImport(d.structName, imports)
+	}
+	d.inputStruct = resolveImport(d.inputStruct, imports)
+}
+
+// resolveImport converts e.g. []*person.ID
+// to []*example.com/app/person.ID.
+func resolveImport(goType []byte, imports map[string]string) []byte {
+	typeStart := len(goType) - len(bytes.TrimLeft(goType, "[]*0123456789"))
+	dot := bytes.LastIndexByte(goType, '.')
+	if dot < typeStart {
+		return goType
+	}
+	importPath, ok := imports[string(goType[typeStart:dot])]
+	if !ok {
+		return goType
+	}
+	resolved := make([]byte, 0, len(goType)+len(importPath))
+	resolved = append(resolved, goType[:typeStart]...)
+	resolved = append(resolved, importPath...)
+	return append(resolved, goType[dot:]...)
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestParseDirectives(t *testing.T) {
+	input := "-- queries of person\n" +
+		"--! package person\n" +
+		"--! output person/queries.gen.go\n" +
+		"--! import \"example.com/app/person\"\n" +
+		"--! import m \"example.com/app/models\"\n" +
+		"\n" +
+		"--- GetPerson -> m.Person {id: person.ID, tags: []*person.Tag}\n" +
+		"select id, tags from person\n"
+	var p parser
+	p.b.WriteString(input)
+	p.calculateNewlineOffsets()
+	if err := p.parseDirectives(); err != nil {
+		t.Fatal(err)
+	}
+	d := p.directives
+	if d.pkg != "person" || d.output != "person/queries.gen.go" || len(d.imports) != 2 ||
+		d.imports["person"] != "example.com/app/person" || d.imports["m"] != "example.com/app/models" {
+		t.Fatalf("got %+v", d)
+	}
+
+	b := &builder{
+		parser: p,
+		config: &config{
+			Package: "queries",
+			Output:  "queries.gen.go",
+			Files: []FileConfig{
+				{Pattern: "other/*.sql", Package: "other"},
+				{Pattern: "person/*.sql", Package: "ignored", Imports: []string{"example.com/app/person", "time"}},
+			},
+		},
+	}
+	file, err := b.fileDirectives("person/queries.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if file.pkg != "person" || len(file.imports) != 3 || file.imports["time"] != "time" {
+		t.Fatalf("got %+v", file)
+	}
+	b.parser.directives = fileDirectives{}
+	file, err = b.fileDirectives("main.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if file.pkg != "queries" || file.output != "queries.gen.go" {
+		t.Fatalf("got %+v", file)
+	}
+	b.outputDir = "gen"
+	if file, err = b.fileDirectives("main.sql"); err != nil || file.output != filepath.Join("gen", "queries.gen.go") {
+		t.Fatalf("got %+v (%v)", file, err)
+	}
+
+	if err := p.buildRawDeclarations(); err != nil {
+		t.Fatal(err)
+	}
+	decl := &p.declarations[0]
+	if err := decl.parse(&p); err != nil {
+		t.Fatal(err)
+	}
+	decl.resolveImports(d.imports)
+	if string(decl.structName) != "example.com/app/models.Person" ||
+		string(decl.columnOptions[0].goType) != "example.com/app/person.ID" ||
+		string(decl.columnOptions[1].goType) != "[]*example.com/app/person.Tag" {
+		t.Fatalf("got %s %s %s", decl.structName, decl.columnOptions[0].goType, decl.columnOptions[1].goType)
+	}
+
+	for _, invalid := range []string{
+		"--! package a b\n",
+		"--! package a\n--! package b\n",
+		"--! import example.com/app\n",
+		"--! import \"example.com/a/x\"\n--! import \"example.com/b/x\"\n",
+		"--! imports \"example.com/app\"\n",
+	} {
+		var p parser
+		p.b.WriteString(invalid)
+		p.calculateNewlineOffsets()
+		if err := p.parseDirectives(); err == nil {
+			t.Fatalf("%q: expected error", invalid)
+		}
+	}
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Entries of config.SQLFiles are files, directories (all .sql files,
+// recursively) or glob patterns, where ** matches any number of
+// directories (e.g. queries/**/*.sql). Files matching a pattern of
+// config.ExcludeSQLFiles are skipped. The files of an entry are sorted,
+// files found by multiple entries are only processed once.
+
+var errNoSQLFiles = errors.New("no sql files to process")
+
+func isGlobPattern(pattern string) bool {
+	return strings.ContainsAny(pattern, "*?[")
+}
+
+// matchGlob is like path.Match, but ** matches zero or more
+// path elements. Both arguments use forward slashes.
+func matchGlob(pattern, name string) (bool, error) {
+	return matchGlobElements(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchGlobElements(pattern, name []string) (bool, error) {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				matched, err := matchGlobElements(pattern[1:], name[i:])
+				if err != nil || matched {
+					return matched, err
+				}
+			}
+			return false, nil
+		}
+		if len(name) == 0 {
+			return false, nil
+		}
+		matched, err := path.Match(pattern[0], name[0])
+		if err != nil || !matched {
+			return false, err
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0, nil
+}
+
+func checkGlob(pattern string) error {
+	for _, element := range strings.Split(pattern, "/") {
+		if _, err := path.Match(element, ""); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// globRoot returns the directory before the first element
+// with a pattern, the walk of the pattern starts there.
+func globRoot(pattern string) string {
+	elements := strings.Split(pattern, "/")
+	for i, element := range elements {
+		if isGlobPattern(element) {
+			if i == 0 {
+				return "."
+			}
+			return strings.Join(elements[:i], "/")
+		}
+	}
+	return pattern
+}
+
+// findSQLFiles expands the entries of config.SQLFiles.
+func findSQLFiles(entries, exclude []string) ([]string, error) {
+	for _, pattern := range exclude {
+		if err := checkGlob(pattern); err != nil {
+			return nil, fmt.Errorf("exclude pattern %q: %w", pattern, err)
+		}
+	}
+	excluded := func(name string) bool {
+		for _, pattern := range exclude {
+			if matched, _ := matchGlob(pattern, name); matched {
+				return true
+			}
+		}
+		return false
+	}
+
+	var files []string
+	seen := make(map[string]bool)
+	for _, entry := range entries {
+		pattern := path.Clean(filepath.ToSlash(entry))
+		var matches []string
+		// maxDepth limits the walk of patterns without **
+		walk := func(root string, maxDepth int, match func(name string) bool) error {
+			return filepath.WalkDir(filepath.FromSlash(root), func(p string, d fs.DirEntry, err error) error {
+				if err != nil {
+					return err
+				}
+				name := filepath.ToSlash(p)
+				if d.IsDir() {
+					if maxDepth > 0 && strings.Count(name, "/")+1 >= maxDepth && name != root {
+						return filepath.SkipDir
+					}
+					return nil
+				}
+				if match(name) {
+					matches = append(matches, name)
+				}
+				return nil
+			})
+		}
+
+		if isGlobPattern(pattern) {
+			if err := checkGlob(pattern); err != nil {
+				return nil, fmt.Errorf("sql files %q: %w", entry, err)
+			}
+			root := globRoot(pattern)
+			if _, err := os.Stat(filepath.FromSlash(root)); errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			maxDepth := strings.Count(pattern, "/") + 1
+			if strings.Contains(pattern, "**") {
+				maxDepth = 0
+			}
+			err := walk(root, maxDepth, func(name string) bool {
+				matched, _ := matchGlob(pattern, name)
+				return matched
+			})
+			if err != nil {
+				return nil, fmt.Errorf("sql files %q: %w", entry, err)
+			}
+		} else if info, err := os.Stat(filepath.FromSlash(pattern)); err == nil && info.IsDir() {
+			err := walk(pattern, 0, func(name string) bool {
+				return strings.HasSuffix(name, ".sql")
+			})
+			if err != nil {
+				return nil, fmt.Errorf("sql files %q: %w", entry, err)
+			}
+		} else {
+			// missing files are reported when they are read
+			matches = append(matches, pattern)
+		}
+
+		sort.Strings(matches)
+		for _, name := range matches {
+			if seen[name] || excluded(name) {
+				continue
+			}
+			seen[name] = true
+			files = append(files, filepath.FromSlash(name))
+		}
+	}
+	if len(files) == 0 {
+		return nil, errNoSQLFiles
+	}
+	return files, nil
+}
+
+// checkPackageNames runs checkDuplicateNames over the queries of all
+// output files of a package, the output files in the same directory.
+func checkPackageNames(outputs []string, queries map[string][]query) error {
+	var dirs []string
+	packageQueries := make(map[string][]query)
+	for _, output := range outputs {
+		dir := filepath.Dir(output)
+		if _, ok := packageQueries[dir]; !ok {
+			dirs = append(dirs, dir)
+		}
+		packageQueries[dir] = append(packageQueries[dir], queries[output]...)
+	}
+	for _, dir := range dirs {
+		if err := checkDuplicateNames(packageQueries[dir]); err != nil {
+			return fmt.Errorf("package in %s: %w", dir, err)
+		}
+	}
+	return nil
+}
+
+// checkDuplicateNames reports functions declared by multiple queries of
+// the same package and structs declared with different columns,
+// with the sources of both declarations.
+func checkDuplicateNames(queries []query) error {
+	funcs := make(map[string]*query)
+	structs := make(map[string]*query)
+	for i := range queries {
+		q := &queries[i]
+		funcName := q.goFuncName()
+		if other, ok := funcs[funcName]; ok {
+			return fmt.Errorf("function %s is declared in %s and %s", funcName, other.source, q.source)
+		}
+		funcs[funcName] = q
+
+		if q.resultKind != resultStruct || isGoTypeReference(q.structName) {
+			continue
+		}
+		other, ok := structs[q.structName]
+		if !ok {
+			structs[q.structName] = q
+			continue
+		}
+		if !sameFields(other.fields, q.fields) {
+			return fmt.Errorf(
+				"struct %s is declared with different columns in %s and %s",
+				q.structName,
+				other.source,
+				q.source,
+			)
+		}
+	}
+	return nil
+}
+
+func sameFields(a, b []field) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].name != b[i].name || !sameType(a[i].typ, b[i].typ) ||
+			a[i].notNull != b[i].notNull || a[i].group != b[i].group {
+			return false
+		}
+	}
+	return true
+}
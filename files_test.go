@@ -0,0 +1,140 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMatchGlob(t *testing.T) {
+	tests := []struct {
+		pattern, name string
+		expected      bool
+	}{
+		{"queries/*.sql", "queries/a.sql", true},
+		{"queries/*.sql", "queries/x/a.sql", false},
+		{"queries/**/*.sql", "queries/a.sql", true},
+		{"queries/**/*.sql", "queries/x/y/a.sql", true},
+		{"**/testdata/**", "a/testdata/b/c.sql", true},
+		{"**/*.sql", "a/b.txt", false},
+	}
+	for _, tt := range tests {
+		matched, err := matchGlob(tt.pattern, tt.name)
+		if err != nil || matched != tt.expected {
+			t.Fatalf("%s %s: got %v (%v), expected %v", tt.pattern, tt.name, matched, err, tt.expected)
+		}
+	}
+}
+
+func TestFindSQLFiles(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{
+		"main.sql",
+		"person/b.sql",
+		"person/a.sql",
+		"person/notes.txt",
+		"person/archive/old.sql",
+		"order/x/y/z.sql",
+	} {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	files, err := findSQLFiles(
+		[]string{"person/b.sql", "person", "*.sql", "order/**/*.sql", "missing.sql"},
+		[]string{"**/archive/**"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"person/b.sql", "person/a.sql", "main.sql", "order/x/y/z.sql", "missing.sql"}
+	got := make([]string, len(files))
+	for i, f := range files {
+		got[i] = filepath.ToSlash(f)
+	}
+	if strings.Join(got, " ") != strings.Join(expected, " ") {
+		t.Fatalf("got %q, expected %q", got, expected)
+	}
+
+	if _, err := findSQLFiles([]string{"none/*.sql"}, nil); err != errNoSQLFiles {
+		t.Fatalf("expected errNoSQLFiles, got %v", err)
+	}
+	if _, err := findSQLFiles([]string{"[.sql"}, nil); err == nil {
+		t.Fatal("expected error for invalid pattern")
+	}
+}
+
+func TestCheckDuplicateNames(t *testing.T) {
+	int8, text := builtinType("int8"), builtinType("text")
+	person := query{
+		resultKind: resultStruct,
+		structName: "Person",
+		source:     "a.sql:1-3",
+		fields:     []field{{name: "id", typ: int8, notNull: true}},
+	}
+	other := person
+	other.funcName, other.source = "GetOtherPerson", "b.sql:4-6"
+	if err := checkDuplicateNames([]query{person, other}); err != nil {
+		t.Fatal(err)
+	}
+
+	other.fields = []field{{name: "name", typ: text}}
+	err := checkDuplicateNames([]query{person, other})
+	if err == nil || err.Error() != "struct Person is declared with different columns in a.sql:1-3 and b.sql:4-6" {
+		t.Fatalf("got %v", err)
+	}
+
+	// overrides like {id: person.ID} create a new type for each query
+	const personID = "example.com/app/person.ID"
+	person.fields = []field{{name: "id", typ: withGoType(int8, personID), notNull: true}}
+	other.fields = []field{{name: "id", typ: withGoType(int8, personID), notNull: true}}
+	if err := checkDuplicateNames([]query{person, other}); err != nil {
+		t.Fatal(err)
+	}
+	other.fields = []field{{name: "id", typ: withGoType(int8, "int"), notNull: true}}
+	if err := checkDuplicateNames([]query{person, other}); err == nil {
+		t.Fatal("expected error for different Go types")
+	}
+
+	other = person
+	other.source = "b.sql:4-6"
+	err = checkDuplicateNames([]query{person, other})
+	if err == nil || err.Error() != "function GetPerson is declared in a.sql:1-3 and b.sql:4-6" {
+		t.Fatalf("got %v", err)
+	}
+}
+
+func TestCheckPackageNames(t *testing.T) {
+	person := query{
+		resultKind: resultStruct,
+		structName: "Person",
+		source:     "a.sql:1-3",
+		fields:     []field{{name: "id", typ: builtinType("int8"), notNull: true}},
+	}
+	other := person
+	other.source = "b.sql:1-3"
+	a, b := filepath.Join("person", "a.gen.go"), filepath.Join("person", "b.gen.go")
+	err := checkPackageNames([]string{a, b}, map[string][]query{a: {person}, b: {other}})
+	if err == nil || !strings.Contains(err.Error(), "function GetPerson is declared in a.sql:1-3 and b.sql:1-3") {
+		t.Fatalf("got %v", err)
+	}
+
+	c := filepath.Join("order", "c.gen.go")
+	if err := checkPackageNames([]string{a, c}, map[string][]query{a: {person}, c: {other}}); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,1147 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/format"
+	goparser "go/parser"
+	"go/scanner"
+	"go/token"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const generatedHeader = "// Code generated by github.com/erikfastermann/sql. DO NOT EDIT.\n"
+
+var errInvalidIdentifier = errors.New("not a valid Go identifier")
+
+// generator collects the declarations of a single Go file.
+// The first error is kept in err, the other methods are no-ops afterwards.
+type generator struct {
+	err error
+
+	imports     map[string]string // path -> name
+	importNames map[string]string // name -> path
+
+	*packageDecls
+	decls   []string
+	helpers []string
+}
+
+// packageDecls are the declarations of a package, shared by the
+// generators of its files. Declarations with the same name and the same
+// source are merged (e.g. a struct used by multiple queries),
+// they are only written into the first file which uses them.
+type packageDecls struct {
+	declared   map[string]string
+	composites map[*compositeType]bool
+	enums      map[*enumType]bool
+	domains    map[*domainType]bool
+}
+
+func newPackageDecls() *packageDecls {
+	return &packageDecls{
+		declared:   make(map[string]string),
+		composites: make(map[*compositeType]bool),
+		enums:      make(map[*enumType]bool),
+		domains:    make(map[*domainType]bool),
+	}
+}
+
+// generate returns the formatted source of the Go file,
+// which is the only file of its package.
+func generate(pkg string, tables []*tableType, queries []query) ([]byte, error) {
+	return newPackageDecls().generate(pkg, tables, queries)
+}
+
+// generate returns the formatted source of a Go file of the package,
+// the row structs of the tables are only passed with the first file.
+func (p *packageDecls) generate(pkg string, tables []*tableType, queries []query) ([]byte, error) {
+	if !token.IsIdentifier(pkg) {
+		return nil, fmt.Errorf("package name %q: %w", pkg, errInvalidIdentifier)
+	}
+	g := &generator{
+		imports:      make(map[string]string),
+		importNames:  make(map[string]string),
+		packageDecls: p,
+	}
+	for _, t := range tables {
+		doc := fmt.Sprintf("// %s is a row of %s.%s.\n", t.goName, t.schema, t.name)
+		g.structDef(t.goName, t.fields, doc)
+		if g.err != nil {
+			return nil, fmt.Errorf("table %s.%s: %w", t.schema, t.name, g.err)
+		}
+	}
+	for i := range queries {
+		q := &queries[i]
+		g.query(q)
+		if g.err != nil {
+			if q.source != "" {
+				return nil, fmt.Errorf("%s: query %s: %w", q.source, q.name(), g.err)
+			}
+			return nil, fmt.Errorf("query %s: %w", q.name(), g.err)
+		}
+	}
+	return g.source(pkg)
+}
+
+func (q *query) name() string {
+	if q.funcName != "" {
+		return q.funcName
+	}
+	return q.structName
+}
+
+// goFuncName returns the name of the generated function.
+func (q *query) goFuncName() string {
+	if q.funcName != "" {
+		return q.funcName
+	}
+	if !isExported(q.structName) {
+		return "get" + q.structName
+	}
+	return "Get" + q.structName
+}
+
+func (g *generator) source(pkg string) ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteString(generatedHeader)
+	b.WriteString("\npackage ")
+	b.WriteString(pkg)
+	b.WriteString("\n")
+
+	used, err := g.usedImportNames()
+	if err != nil {
+		return nil, err
+	}
+	paths := make([]string, 0, len(g.imports))
+	for importPath, name := range g.imports {
+		if used[name] {
+			paths = append(paths, importPath)
+		}
+	}
+	if len(paths) > 0 {
+		// standard library first
+		sort.Slice(paths, func(i, j int) bool {
+			iStd, jStd := isStandardLibrary(paths[i]), isStandardLibrary(paths[j])
+			if iStd != jStd {
+				return iStd
+			}
+			return paths[i] < paths[j]
+		})
+		b.WriteString("\nimport (\n")
+		for i, importPath := range paths {
+			if i > 0 && isStandardLibrary(paths[i-1]) != isStandardLibrary(importPath) {
+				b.WriteByte('\n')
+			}
+			name := g.imports[importPath]
+			if name != path.Base(importPath) {
+				b.WriteString(name)
+				b.WriteByte(' ')
+			}
+			b.WriteString(strconv.Quote(importPath))
+			b.WriteByte('\n')
+		}
+		b.WriteString(")\n")
+	}
+
+	for _, decl := range g.decls {
+		b.WriteByte('\n')
+		b.WriteString(decl)
+	}
+	for _, decl := range g.helpers {
+		b.WriteByte('\n')
+		b.WriteString(decl)
+	}
+
+	source, err := format.Source(b.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("format generated code: %w", err)
+	}
+	return source, nil
+}
+
+// usedImportNames returns the package names referenced by the
+// declarations of the file. Declarations already written into another
+// file of the package can leave imports of the file unused.
+func (g *generator) usedImportNames() (map[string]bool, error) {
+	var b strings.Builder
+	b.WriteString("package p\n")
+	for _, decl := range g.decls {
+		b.WriteString(decl)
+	}
+	for _, decl := range g.helpers {
+		b.WriteString(decl)
+	}
+	file, err := goparser.ParseFile(token.NewFileSet(), "", b.String(), goparser.SkipObjectResolution)
+	if err != nil {
+		return nil, fmt.Errorf("parse generated code: %w", err)
+	}
+	used := make(map[string]bool)
+	ast.Inspect(file, func(n ast.Node) bool {
+		if selector, ok := n.(*ast.SelectorExpr); ok {
+			if ident, ok := selector.X.(*ast.Ident); ok && g.importNames[ident.Name] != "" {
+				used[ident.Name] = true
+			}
+		}
+		return true
+	})
+	return used, nil
+}
+
+func isStandardLibrary(importPath string) bool {
+	first, _, _ := strings.Cut(importPath, "/")
+	return !strings.Contains(first, ".")
+}
+
+func (g *generator) setError(err error) {
+	if g.err == nil {
+		g.err = err
+	}
+}
+
+func (g *generator) declare(name, source string, helper bool) {
+	if g.err != nil {
+		return
+	}
+	if !token.IsIdentifier(name) {
+		g.setError(fmt.Errorf("%q: %w", name, errInvalidIdentifier))
+		return
+	}
+	if existing, ok := g.declared[name]; ok {
+		// the documentation of the first declaration is kept
+		if withoutDoc(existing) != withoutDoc(source) {
+			g.setError(fmt.Errorf("%s is declared multiple times", name))
+		}
+		return
+	}
+	g.declared[name] = source
+	if helper {
+		g.helpers = append(g.helpers, source)
+	} else {
+		g.decls = append(g.decls, source)
+	}
+}
+
+// withoutDoc removes the leading comment lines of source.
+func withoutDoc(source string) string {
+	for strings.HasPrefix(source, "//") {
+		i := strings.IndexByte(source, '\n')
+		if i < 0 {
+			return ""
+		}
+		source = source[i+1:]
+	}
+	return source
+}
+
+// reserve declares a name which is part of the source of another declaration.
+func (g *generator) reserve(name, source string) {
+	if g.err != nil {
+		return
+	}
+	if existing, ok := g.declared[name]; ok && existing != source {
+		g.setError(fmt.Errorf("%s is declared multiple times", name))
+		return
+	}
+	g.declared[name] = source
+}
+
+func (g *generator) importName(importPath string) string {
+	if name, ok := g.imports[importPath]; ok {
+		return name
+	}
+	base := path.Base(importPath)
+	if i := strings.IndexByte(base, '.'); i >= 0 {
+		base = base[:i]
+	}
+	base = strings.ReplaceAll(base, "-", "_")
+	name := base
+	for i := 2; ; i++ {
+		if _, ok := g.importNames[name]; !ok {
+			break
+		}
+		name = base + strconv.Itoa(i)
+	}
+	g.imports[importPath] = name
+	g.importNames[name] = importPath
+	return name
+}
+
+func (g *generator) runtime() string {
+	return g.importName(runtimePackage) + "."
+}
+
+// goType converts the format of TypeInfo.Go (e.g. []*math/big.Rat)
+// to a Go type expression, the package is imported if necessary.
+func (g *generator) goType(typ string) string {
+	prefixEnd := 0
+loop:
+	for {
+		rest := typ[prefixEnd:]
+		switch {
+		case strings.HasPrefix(rest, "[]"):
+			prefixEnd += 2
+		case strings.HasPrefix(rest, "*"):
+			prefixEnd++
+		case strings.HasPrefix(rest, "["):
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				break loop
+			}
+			prefixEnd += end + 1
+		default:
+			break loop
+		}
+	}
+	prefix, name := typ[:prefixEnd], typ[prefixEnd:]
+	dot := strings.LastIndexByte(name, '.')
+	if dot < 0 {
+		return typ
+	}
+	return prefix + g.importName(name[:dot]) + name[dot:]
+}
+
+func (g *generator) typeExpr(typ *resolvedType) string {
+	switch typ.kind {
+	case typeScalar:
+		return g.goType(typ.goType)
+	case typeArray:
+		return "[]" + g.typeExpr(typ.elem)
+	case typeComposite:
+		g.composite(typ.composite)
+		return typ.composite.goName
+	case typeEnum:
+		g.enum(typ.enum)
+		return typ.enum.goName
+	case typeDomain:
+		g.domain(typ.domain)
+		return typ.domain.goName
+	case typeConverted:
+		return g.goType(typ.goType)
+	default:
+		panic("internal error")
+	}
+}
+
+type sqlNullType struct {
+	name  string
+	field string
+}
+
+var sqlNullTypes = map[string]sqlNullType{
+	"bool":      {"NullBool", "Bool"},
+	"byte":      {"NullByte", "Byte"},
+	"float64":   {"NullFloat64", "Float64"},
+	"int16":     {"NullInt16", "Int16"},
+	"int32":     {"NullInt32", "Int32"},
+	"int64":     {"NullInt64", "Int64"},
+	"string":    {"NullString", "String"},
+	"time.Time": {"NullTime", "Time"},
+}
+
+// nilPointer is used instead of nullablePointer
+// if the Go type is already a pointer.
+const nilPointer nullableStrategy = -1
+
+func nullable(typ *resolvedType) nullableStrategy {
+	strategy := typ.nullable
+	if strategy == nullableDefault {
+		strategy = nullablePointer
+	}
+	if strategy == nullableSQL {
+		if _, ok := sqlNullTypes[typ.goType]; !ok {
+			strategy = nullablePointer
+		}
+	}
+	if strategy == nullablePointer && strings.HasPrefix(typ.goType, "*") {
+		strategy = nilPointer
+	}
+	return strategy
+}
+
+func (g *generator) fieldTypeExpr(typ *resolvedType, notNull bool) string {
+	if notNull {
+		return g.typeExpr(typ)
+	}
+	switch nullable(typ) {
+	case nilPointer:
+		return g.typeExpr(typ)
+	case nullablePointer:
+		return "*" + g.typeExpr(typ)
+	case nullableGeneric:
+		return g.runtime() + "Null[" + g.typeExpr(typ) + "]"
+	case nullableSQL:
+		return g.importName("database/sql") + "." + sqlNullTypes[typ.goType].name
+	default:
+		panic("internal error")
+	}
+}
+
+// nullableValue converts the non-null value expr to the nullable representation.
+func (g *generator) nullableValue(typ *resolvedType, expr string) string {
+	switch nullable(typ) {
+	case nilPointer:
+		return expr
+	case nullablePointer:
+		return "&" + expr
+	case nullableGeneric, nullableSQL:
+		return fmt.Sprintf("%s{%s: %s, Valid: true}", g.fieldTypeExpr(typ, false), nullableField(typ), expr)
+	default:
+		panic("internal error")
+	}
+}
+
+func nullableField(typ *resolvedType) string {
+	if nullable(typ) == nullableSQL {
+		return sqlNullTypes[typ.goType].field
+	}
+	return "V"
+}
+
+func convert(typeExpr, expr string) string {
+	if strings.HasPrefix(typeExpr, "*") {
+		typeExpr = "(" + typeExpr + ")"
+	}
+	return typeExpr + "(" + expr + ")"
+}
+
+// decoder returns an expression of the type func(format int, b []byte) (T, error).
+func (g *generator) decoder(typ *resolvedType) string {
+	switch typ.kind {
+	case typeScalar:
+		if typ.goType == typ.codec.goType {
+			return g.runtime() + "Decode" + typ.codec.name
+		}
+		return g.convertingDecoder(typ, g.runtime()+"Decode"+typ.codec.name)
+	case typeArray:
+		return fmt.Sprintf(
+			"%sArrayDecoder(%s, %s)",
+			g.runtime(),
+			strconv.QuoteRune(rune(typ.delimiter)),
+			g.decoder(typ.elem),
+		)
+	case typeComposite:
+		g.composite(typ.composite)
+		return "decode" + typ.composite.goName
+	case typeEnum:
+		g.enum(typ.enum)
+		return "decode" + typ.enum.goName
+	case typeDomain:
+		g.domain(typ.domain)
+		return "decode" + typ.domain.goName
+	case typeConverted:
+		return g.convertingDecoder(typ, g.decoder(typ.original))
+	default:
+		panic("internal error")
+	}
+}
+
+// encoder returns an expression of the type func(b []byte, v T) []byte.
+func (g *generator) encoder(typ *resolvedType) string {
+	switch typ.kind {
+	case typeScalar:
+		if typ.goType == typ.codec.goType {
+			return g.runtime() + "Append" + typ.codec.name
+		}
+		return g.convertingEncoder(typ, g.runtime()+"Append"+typ.codec.name, g.goType(typ.codec.goType))
+	case typeArray:
+		return fmt.Sprintf(
+			"%sArrayEncoder(%s, %s)",
+			g.runtime(),
+			strconv.QuoteRune(rune(typ.delimiter)),
+			g.encoder(typ.elem),
+		)
+	case typeComposite:
+		g.composite(typ.composite)
+		return "append" + typ.composite.goName
+	case typeEnum:
+		g.enum(typ.enum)
+		return "append" + typ.enum.goName
+	case typeDomain:
+		g.domain(typ.domain)
+		return "append" + typ.domain.goName
+	case typeConverted:
+		return g.convertingEncoder(typ, g.encoder(typ.original), g.typeExpr(typ.original))
+	default:
+		panic("internal error")
+	}
+}
+
+// conversionName returns e.g. decodeInt8AsPersonID.
+func (g *generator) conversionName(prefix string, typ *resolvedType) string {
+	var b strings.Builder
+	b.WriteString(prefix)
+	b.WriteString(exportedName(typ.postgres))
+	b.WriteString("As")
+	typeExpr := g.typeExpr(typ)
+	for {
+		switch {
+		case strings.HasPrefix(typeExpr, "[]"):
+			b.WriteString("Slice")
+			typeExpr = typeExpr[2:]
+			continue
+		case strings.HasPrefix(typeExpr, "*"):
+			b.WriteString("Pointer")
+			typeExpr = typeExpr[1:]
+			continue
+		case strings.HasPrefix(typeExpr, "["):
+			b.WriteString("Array")
+			typeExpr = typeExpr[1:]
+			continue
+		}
+		break
+	}
+	b.WriteString(enumConstName(typeExpr))
+	return b.String()
+}
+
+// convertingDecoder declares a decoder of typ which converts the result of decode.
+func (g *generator) convertingDecoder(typ *resolvedType, decode string) string {
+	name := g.conversionName("decode", typ)
+	var b strings.Builder
+	fmt.Fprintf(&b, "func %s(format int, b []byte) (%s, error) {\n", name, g.typeExpr(typ))
+	fmt.Fprintf(&b, "v, err := %s(format, b)\n", decode)
+	fmt.Fprintf(&b, "return %s, err\n", convert(g.typeExpr(typ), "v"))
+	b.WriteString("}\n")
+	g.declare(name, b.String(), true)
+	return name
+}
+
+// convertingEncoder declares an encoder of typ which converts to the argument type of encode.
+func (g *generator) convertingEncoder(typ *resolvedType, encode, encodeType string) string {
+	name := g.conversionName("append", typ)
+	var b strings.Builder
+	fmt.Fprintf(&b, "func %s(b []byte, v %s) []byte {\n", name, g.typeExpr(typ))
+	fmt.Fprintf(&b, "return %s(b, %s)\n", encode, convert(encodeType, "v"))
+	b.WriteString("}\n")
+	g.declare(name, b.String(), true)
+	return name
+}
+
+func (g *generator) value(expr string, typ *resolvedType, notNull bool) string {
+	if notNull {
+		return fmt.Sprintf("%sValue(%s, %s)", g.runtime(), expr, g.encoder(typ))
+	}
+	switch nullable(typ) {
+	case nilPointer:
+		return fmt.Sprintf("%sValidValue(%s, %s != nil, %s)", g.runtime(), expr, expr, g.encoder(typ))
+	case nullablePointer:
+		return fmt.Sprintf("%sPointerValue(%s, %s)", g.runtime(), expr, g.encoder(typ))
+	case nullableGeneric, nullableSQL:
+		return fmt.Sprintf(
+			"%sValidValue(%s.%s, %s.Valid, %s)",
+			g.runtime(),
+			expr,
+			nullableField(typ),
+			expr,
+			g.encoder(typ),
+		)
+	default:
+		panic("internal error")
+	}
+}
+
+// assign writes the decoding of a single value to target,
+// source is a format string of the runtime call
+// with the function name and the decoder as arguments.
+func (g *generator) assign(b *strings.Builder, target, source string, typ *resolvedType, notNull bool) {
+	if notNull {
+		fmt.Fprintf(b, "if %s, err = %s; err != nil {\n", target, fmt.Sprintf(source, "", g.decoder(typ)))
+		b.WriteString("return v, err\n}\n")
+		return
+	}
+	fmt.Fprintf(b, "{\nx, ok, err := %s\n", fmt.Sprintf(source, "Maybe", g.decoder(typ)))
+	b.WriteString("if err != nil {\nreturn v, err\n}\n")
+	fmt.Fprintf(b, "if ok {\n%s = %s\n}\n}\n", target, g.nullableValue(typ, "x"))
+}
+
+// declareErr declares err if it is used by assign.
+func declareErr(b *strings.Builder, fields []field) {
+	for _, f := range fields {
+		if f.notNull {
+			b.WriteString("var err error\n")
+			return
+		}
+	}
+}
+
+func (g *generator) composite(composite *compositeType) {
+	if g.composites[composite] {
+		return
+	}
+	g.composites[composite] = true
+	name := composite.goName
+
+	var def strings.Builder
+	fmt.Fprintf(&def, "// %s is the composite type %s.\n", name, composite.postgres)
+	fmt.Fprintf(&def, "type %s struct {\n", name)
+	for _, f := range composite.fields {
+		if !token.IsIdentifier(f.goName) {
+			g.setError(fmt.Errorf("composite type %s, field %s: %w", composite.postgres, f.name, errInvalidIdentifier))
+			return
+		}
+		fmt.Fprintf(&def, "%s %s\n", f.goName, g.fieldTypeExpr(f.typ, f.notNull))
+	}
+	def.WriteString("}\n")
+	g.declare(name, def.String(), false)
+
+	var dec strings.Builder
+	fmt.Fprintf(&dec, "func decode%s(format int, b []byte) (%s, error) {\n", name, name)
+	fmt.Fprintf(&dec, "var v %s\n", name)
+	fmt.Fprintf(&dec, "fields, err := %sParseRecordLength(format, b, %d)\n", g.runtime(), len(composite.fields))
+	dec.WriteString("if err != nil {\nreturn v, err\n}\n")
+	for i, f := range composite.fields {
+		source := g.runtime() + "Decode%sRecordField(format, fields, " + strconv.Itoa(i) + ", %s)"
+		g.assign(&dec, "v."+f.goName, source, f.typ, f.notNull)
+	}
+	dec.WriteString("return v, nil\n}\n")
+	g.declare("decode"+name, dec.String(), true)
+
+	var enc strings.Builder
+	fmt.Fprintf(&enc, "func append%s(b []byte, v %s) []byte {\n", name, name)
+	fmt.Fprintf(&enc, "return %sAppendRecord(b, []%sRawValue{\n", g.runtime(), g.runtime())
+	for _, f := range composite.fields {
+		fmt.Fprintf(&enc, "%s,\n", g.value("v."+f.goName, f.typ, f.notNull))
+	}
+	enc.WriteString("})\n}\n")
+	g.declare("append"+name, enc.String(), true)
+}
+
+func (g *generator) enum(enum *enumType) {
+	if g.enums[enum] {
+		return
+	}
+	g.enums[enum] = true
+	name := enum.goName
+
+	constNames := make([]string, len(enum.labels))
+	for i, label := range enum.labels {
+		suffix := enumConstName(label)
+		if suffix == "" {
+			// e.g. '-', the constant would be the type name
+			suffix = "Label" + strconv.Itoa(i+1)
+		}
+		constNames[i] = name + suffix
+		if !token.IsIdentifier(constNames[i]) {
+			g.setError(fmt.Errorf("enum type %s, label %q: %w", enum.postgres, label, errInvalidIdentifier))
+			return
+		}
+		for _, other := range constNames[:i] {
+			if other == constNames[i] {
+				g.setError(fmt.Errorf("enum type %s: duplicate constant %s", enum.postgres, other))
+				return
+			}
+		}
+	}
+
+	var def strings.Builder
+	fmt.Fprintf(&def, "// %s is the enum type %s.\n", name, enum.postgres)
+	fmt.Fprintf(&def, "type %s string\n\n", name)
+	if len(enum.labels) > 0 {
+		def.WriteString("const (\n")
+		for i, label := range enum.labels {
+			fmt.Fprintf(&def, "%s %s = %s\n", constNames[i], name, strconv.Quote(label))
+		}
+		def.WriteString(")\n\n")
+	}
+	fmt.Fprintf(&def, "// Valid reports whether v is a label of %s.\n", enum.postgres)
+	fmt.Fprintf(&def, "func (v %s) Valid() bool {\n", name)
+	if len(enum.labels) > 0 {
+		fmt.Fprintf(&def, "switch v {\ncase %s:\nreturn true\n}\n", strings.Join(constNames, ", "))
+	}
+	def.WriteString("return false\n}\n\n")
+	fmt.Fprintf(&def, "func (v %s) String() string {\nreturn string(v)\n}\n", name)
+	g.declare(name, def.String(), false)
+	for _, constName := range constNames {
+		g.reserve(constName, def.String())
+	}
+
+	var dec strings.Builder
+	fmt.Fprintf(&dec, "func decode%s(format int, b []byte) (%s, error) {\n", name, name)
+	fmt.Fprintf(
+		&dec,
+		"return %sDecodeEnum(format, b, %s, %s.Valid)\n}\n",
+		g.runtime(),
+		strconv.Quote(enum.postgres),
+		name,
+	)
+	g.declare("decode"+name, dec.String(), true)
+
+	var enc strings.Builder
+	fmt.Fprintf(&enc, "func append%s(b []byte, v %s) []byte {\n", name, name)
+	fmt.Fprintf(&enc, "return %sAppendString(b, string(v))\n}\n", g.runtime())
+	g.declare("append"+name, enc.String(), true)
+}
+
+func (g *generator) domain(domain *domainType) {
+	if g.domains[domain] {
+		return
+	}
+	g.domains[domain] = true
+	name := domain.goName
+	base := g.typeExpr(domain.base)
+
+	var def strings.Builder
+	fmt.Fprintf(&def, "// %s is the domain %s.\n", name, domain.postgres)
+	fmt.Fprintf(&def, "type %s %s\n", name, base)
+	g.declare(name, def.String(), false)
+
+	var dec strings.Builder
+	fmt.Fprintf(&dec, "func decode%s(format int, b []byte) (%s, error) {\n", name, name)
+	fmt.Fprintf(&dec, "v, err := %s(format, b)\n", g.decoder(domain.base))
+	fmt.Fprintf(&dec, "return %s(v), err\n}\n", name)
+	g.declare("decode"+name, dec.String(), true)
+
+	var enc strings.Builder
+	fmt.Fprintf(&enc, "func append%s(b []byte, v %s) []byte {\n", name, name)
+	fmt.Fprintf(&enc, "return %s(b, %s)\n}\n", g.encoder(domain.base), convert(base, "v"))
+	g.declare("append"+name, enc.String(), true)
+}
+
+// enumConstName converts e.g. in-progress to InProgress,
+// every character other than a letter or digit separates words.
+func enumConstName(label string) string {
+	var b strings.Builder
+	upper := true
+	for _, r := range label {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			upper = true
+			continue
+		}
+		if upper {
+			r = unicode.ToUpper(r)
+			upper = false
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func (g *generator) query(q *query) {
+	funcName := q.goFuncName()
+	constName := "query" + upperFirst(funcName)
+
+	var constDef strings.Builder
+	fmt.Fprintf(&constDef, "const %s = %s\n", constName, quoteSQL(q.body))
+	g.declare(constName, constDef.String(), false)
+
+	var b strings.Builder
+	b.WriteString(queryDoc(funcName, q))
+	fmt.Fprintf(&b, "func %s(c *%sConn", funcName, g.runtime())
+	var names []string
+	if q.inputStruct != "" {
+		var typ string
+		typ, names = g.inputStruct(funcName, q)
+		fmt.Fprintf(&b, ", in %s", typ)
+	} else {
+		// the names are chosen after the body is known
+		names = make([]string, len(q.parameters))
+		for i := range names {
+			names[i] = parameterPlaceholder(i)
+		}
+		for i, p := range q.parameters {
+			fmt.Fprintf(&b, ", %s %s", names[i], g.fieldTypeExpr(p.typ, p.notNull))
+		}
+	}
+	b.WriteString(") ")
+
+	parameters := "nil"
+	if len(q.parameters) > 0 {
+		var p strings.Builder
+		fmt.Fprintf(&p, "[]%sRawValue{\n", g.runtime())
+		for i, param := range q.parameters {
+			fmt.Fprintf(&p, "%s,\n", g.value(names[i], param.typ, param.notNull))
+		}
+		p.WriteString("}")
+		parameters = p.String()
+	}
+
+	switch q.resultKind {
+	case resultNone:
+		b.WriteString("error {\n")
+		fmt.Fprintf(&b, "return c.ExecuteParams(%s, %s)\n", constName, parameters)
+	case resultStruct:
+		structType := q.structName
+		var scanName string
+		if isGoTypeReference(q.structName) {
+			structType = g.goType(q.structName)
+			scanName = g.scanExisting(structType, q.fields)
+		} else {
+			doc := fmt.Sprintf("// %s is the result of %s.\n", q.structName, funcName)
+			if len(q.doc) > 0 {
+				doc += "//\n" + commentLines(q.doc)
+			}
+			scanName = g.scanStruct(q.structName, q.fields, doc)
+		}
+		switch q.resultCount {
+		case resultOne:
+			fmt.Fprintf(&b, "(%s, error) {\n", structType)
+			fmt.Fprintf(&b, "return %sQueryOne(c, %s, %s, %s)\n", g.runtime(), constName, parameters, scanName)
+		case resultOption:
+			fmt.Fprintf(&b, "(%s, bool, error) {\n", structType)
+			fmt.Fprintf(&b, "return %sQueryOption(c, %s, %s, %s)\n", g.runtime(), constName, parameters, scanName)
+		case resultMany:
+			fmt.Fprintf(&b, "([]%s, error) {\n", structType)
+			fmt.Fprintf(&b, "return %sQueryMany(c, %s, %s, %s)\n", g.runtime(), constName, parameters, scanName)
+		default:
+			panic("internal error")
+		}
+	case resultDirect:
+		g.queryDirect(&b, funcName, constName, parameters, q)
+	default:
+		panic("internal error")
+	}
+	b.WriteString("}\n")
+	source := b.String()
+	if q.inputStruct == "" && len(q.parameters) > 0 {
+		source = g.replaceParameterPlaceholders(source, q.parameters)
+	}
+	g.declare(funcName, source, false)
+}
+
+func parameterPlaceholder(index int) string {
+	return "__parameter" + strconv.Itoa(index) + "__"
+}
+
+// replaceParameterPlaceholders names the parameters of the query function,
+// the names do not shadow identifiers used by the function
+// (e.g. the query constant or the encoders).
+func (g *generator) replaceParameterPlaceholders(source string, parameters []parameter) string {
+	used := make(map[string]bool)
+	var s scanner.Scanner
+	fset := token.NewFileSet()
+	s.Init(fset.AddFile("", fset.Base(), len(source)), []byte(source), nil, 0)
+	for {
+		_, tok, lit := s.Scan()
+		if tok == token.EOF {
+			break
+		}
+		if tok == token.IDENT && !strings.HasPrefix(lit, "__parameter") {
+			used[lit] = true
+		}
+	}
+	names := g.parameterNames(parameters, used)
+	replacements := make([]string, 0, 2*len(names))
+	for i, name := range names {
+		replacements = append(replacements, parameterPlaceholder(i), name)
+	}
+	return strings.NewReplacer(replacements...).Replace(source)
+}
+
+// queryDoc returns the documentation of the query function,
+// followed by the SQL as a code block.
+func queryDoc(funcName string, q *query) string {
+	var b strings.Builder
+	if len(q.doc) > 0 {
+		b.WriteString(commentLines(q.doc))
+	} else {
+		fmt.Fprintf(&b, "// %s runs the query:\n", funcName)
+	}
+	text := q.text
+	if text == "" {
+		text = q.body
+	}
+	b.WriteString("//\n")
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimRightFunc(line, unicode.IsSpace)
+		if line == "" {
+			b.WriteString("//\n")
+		} else {
+			fmt.Fprintf(&b, "//\t%s\n", line)
+		}
+	}
+	return b.String()
+}
+
+// commentLines converts the lines to line comments.
+func commentLines(lines []string) string {
+	var b strings.Builder
+	for _, line := range lines {
+		if line == "" {
+			b.WriteString("//\n")
+		} else {
+			fmt.Fprintf(&b, "// %s\n", line)
+		}
+	}
+	return b.String()
+}
+
+// inputStruct declares the struct passed instead of the parameters,
+// unless it references an existing Go type. It returns the type
+// and the field expressions of the parameters.
+func (g *generator) inputStruct(funcName string, q *query) (string, []string) {
+	referenced := strings.Contains(q.inputStruct, ".")
+	var def strings.Builder
+	fmt.Fprintf(&def, "// %s is the input of %s.\n", q.inputStruct, funcName)
+	fmt.Fprintf(&def, "type %s struct {\n", q.inputStruct)
+	fields := make([]string, len(q.parameters))
+	seen := make(map[string]bool, len(q.parameters))
+	for i, p := range q.parameters {
+		goName := exportedName(p.name)
+		if !token.IsIdentifier(goName) {
+			g.setError(fmt.Errorf("parameter %q: %w", p.name, errInvalidIdentifier))
+			return "", nil
+		}
+		if seen[goName] {
+			g.setError(fmt.Errorf("duplicate struct field %s", goName))
+			return "", nil
+		}
+		seen[goName] = true
+		fields[i] = "in." + goName
+		if referenced && p.goName != "" {
+			fields[i] = "in." + p.goName
+		}
+		if !referenced {
+			// only the declaration uses the imports of the field types
+			fmt.Fprintf(&def, "%s %s\n", goName, g.fieldTypeExpr(p.typ, p.notNull))
+		}
+	}
+	def.WriteString("}\n")
+
+	if referenced {
+		return g.goType(q.inputStruct), fields
+	}
+	g.declare(q.inputStruct, def.String(), false)
+	return q.inputStruct, fields
+}
+
+// parameterNames converts the parameter names to Go identifiers,
+// which do not shadow the identifiers used by the function.
+// Unnamed or conflicting parameters are called p1, p2, ...
+func (g *generator) parameterNames(parameters []parameter, used map[string]bool) []string {
+	reserved := map[string]bool{
+		"c":                                  true,
+		"v":                                  true,
+		"ok":                                 true,
+		"err":                                true,
+		strings.TrimSuffix(g.runtime(), "."): true,
+	}
+	names := make([]string, len(parameters))
+	counts := make(map[string]int, len(parameters))
+	for i, p := range parameters {
+		name := unexportedName(p.name)
+		if token.IsKeyword(name) || reserved[name] || used[name] {
+			name += "Arg"
+		}
+		if !token.IsIdentifier(name) || isPositionalName(name) {
+			name = ""
+		}
+		names[i] = name
+		counts[name]++
+	}
+	for i, name := range names {
+		if name == "" || counts[name] > 1 {
+			names[i] = "p" + strconv.Itoa(i+1)
+		}
+	}
+	return names
+}
+
+func isPositionalName(name string) bool {
+	if len(name) < 2 || name[0] != 'p' {
+		return false
+	}
+	for i := 1; i < len(name); i++ {
+		if !isDigit(name[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// structDef declares the struct of the fields and
+// returns the selectors of the fields.
+func (g *generator) structDef(structName string, fields []field, doc string) []string {
+	goNames := make([]string, len(fields))
+	seen := make(map[string]bool, len(fields))
+	var groups []string
+	groupFields := make(map[string][]int)
+	for i, f := range fields {
+		goName := exportedName(f.name)
+		if !token.IsIdentifier(goName) {
+			g.setError(fmt.Errorf("field %q: %w", f.name, errInvalidIdentifier))
+			return nil
+		}
+		if f.group != "" {
+			group := exportedName(f.group)
+			if !token.IsIdentifier(group) {
+				g.setError(fmt.Errorf("table %q: %w", f.group, errInvalidIdentifier))
+				return nil
+			}
+			if _, ok := groupFields[group]; !ok {
+				groups = append(groups, group)
+			}
+			groupFields[group] = append(groupFields[group], i)
+			goName = group + "." + goName
+		} else {
+			groups = append(groups, "")
+			groupFields[""] = append(groupFields[""], i)
+		}
+		if seen[goName] {
+			g.setError(fmt.Errorf("duplicate struct field %s", goName))
+			return nil
+		}
+		seen[goName] = true
+		goNames[i] = goName
+	}
+
+	var def strings.Builder
+	def.WriteString(doc)
+	fmt.Fprintf(&def, "type %s struct {\n", structName)
+	next := 0
+	for _, group := range groups {
+		if group == "" {
+			// top level fields keep their position
+			f := fields[groupFields[""][next]]
+			fmt.Fprintf(&def, "%s %s\n", goNames[groupFields[""][next]], g.fieldTypeExpr(f.typ, f.notNull))
+			next++
+			continue
+		}
+		if seen[group] {
+			g.setError(fmt.Errorf("duplicate struct field %s", group))
+			return nil
+		}
+		seen[group] = true
+		fmt.Fprintf(&def, "%s struct {\n", group)
+		for _, i := range groupFields[group] {
+			f := fields[i]
+			fmt.Fprintf(&def, "%s %s\n", exportedName(f.name), g.fieldTypeExpr(f.typ, f.notNull))
+		}
+		def.WriteString("}\n")
+	}
+	def.WriteString("}\n")
+	g.declare(structName, def.String(), false)
+	return goNames
+}
+
+func (g *generator) scanStruct(structName string, fields []field, doc string) string {
+	goNames := g.structDef(structName, fields, doc)
+	if goNames == nil {
+		return ""
+	}
+	return g.scanFunc("scan"+upperFirst(structName), structName, fields, goNames)
+}
+
+// scanExisting scans into an existing Go struct,
+// the fields are matched by the builder.
+func (g *generator) scanExisting(structType string, fields []field) string {
+	goNames := make([]string, len(fields))
+	for i, f := range fields {
+		goNames[i] = f.goName
+	}
+	scanName := "scan" + upperFirst(strings.ReplaceAll(structType, ".", ""))
+	return g.scanFunc(scanName, structType, fields, goNames)
+}
+
+func (g *generator) scanFunc(scanName, structType string, fields []field, goNames []string) string {
+	var scan strings.Builder
+	fmt.Fprintf(&scan, "func %s(c *%sConn) (%s, error) {\n", scanName, g.runtime(), structType)
+	fmt.Fprintf(&scan, "var v %s\n", structType)
+	declareErr(&scan, fields)
+	for i, f := range fields {
+		source := g.runtime() + "Scan%sField(c, " + strconv.Itoa(i) + ", %s)"
+		g.assign(&scan, "v."+goNames[i], source, f.typ, f.notNull)
+	}
+	scan.WriteString("return v, nil\n}\n")
+	g.declare(scanName, scan.String(), true)
+	return scanName
+}
+
+// queryDirect returns the columns as multiple values,
+// they are scanned into an unexported struct first.
+func (g *generator) queryDirect(b *strings.Builder, funcName, constName, parameters string, q *query) {
+	scanName := "scan" + upperFirst(funcName)
+	var scan strings.Builder
+	var resultTypes []string
+	var resultValues []string
+	if len(q.fields) == 1 {
+		f := q.fields[0]
+		typ := g.fieldTypeExpr(f.typ, f.notNull)
+		resultTypes = append(resultTypes, typ)
+		fmt.Fprintf(&scan, "func %s(c *%sConn) (%s, error) {\n", scanName, g.runtime(), typ)
+		fmt.Fprintf(&scan, "var v %s\n", typ)
+		declareErr(&scan, q.fields)
+		g.assign(&scan, "v", g.runtime()+"Scan%sField(c, 0, %s)", f.typ, f.notNull)
+		resultValues = append(resultValues, "v")
+	} else {
+		rowName := lowerFirst(funcName) + "Row"
+		var def strings.Builder
+		fmt.Fprintf(&def, "type %s struct {\n", rowName)
+		for i, f := range q.fields {
+			typ := g.fieldTypeExpr(f.typ, f.notNull)
+			resultTypes = append(resultTypes, typ)
+			resultValues = append(resultValues, "v.f"+strconv.Itoa(i))
+			fmt.Fprintf(&def, "f%d %s\n", i, typ)
+		}
+		def.WriteString("}\n")
+		g.declare(rowName, def.String(), true)
+
+		fmt.Fprintf(&scan, "func %s(c *%sConn) (%s, error) {\n", scanName, g.runtime(), rowName)
+		fmt.Fprintf(&scan, "var v %s\n", rowName)
+		declareErr(&scan, q.fields)
+		for i, f := range q.fields {
+			source := g.runtime() + "Scan%sField(c, " + strconv.Itoa(i) + ", %s)"
+			g.assign(&scan, resultValues[i], source, f.typ, f.notNull)
+		}
+	}
+	scan.WriteString("return v, nil\n}\n")
+	g.declare(scanName, scan.String(), true)
+
+	results := strings.Join(resultTypes, ", ")
+	values := strings.Join(resultValues, ", ")
+	switch q.resultCount {
+	case resultOne:
+		fmt.Fprintf(b, "(%s, error) {\n", results)
+		if len(q.fields) == 1 {
+			fmt.Fprintf(b, "return %sQueryOne(c, %s, %s, %s)\n", g.runtime(), constName, parameters, scanName)
+			return
+		}
+		fmt.Fprintf(b, "v, err := %sQueryOne(c, %s, %s, %s)\n", g.runtime(), constName, parameters, scanName)
+		fmt.Fprintf(b, "return %s, err\n", values)
+	case resultOption:
+		fmt.Fprintf(b, "(%s, bool, error) {\n", results)
+		if len(q.fields) == 1 {
+			fmt.Fprintf(b, "return %sQueryOption(c, %s, %s, %s)\n", g.runtime(), constName, parameters, scanName)
+			return
+		}
+		fmt.Fprintf(b, "v, ok, err := %sQueryOption(c, %s, %s, %s)\n", g.runtime(), constName, parameters, scanName)
+		fmt.Fprintf(b, "return %s, ok, err\n", values)
+	case resultMany:
+		if len(q.fields) != 1 {
+			panic("internal error")
+		}
+		fmt.Fprintf(b, "([]%s, error) {\n", results)
+		fmt.Fprintf(b, "return %sQueryMany(c, %s, %s, %s)\n", g.runtime(), constName, parameters, scanName)
+	default:
+		panic("internal error")
+	}
+}
+
+func quoteSQL(body string) string {
+	if strings.Contains(body, "`") || strings.Contains(body, "\r") {
+		return strconv.Quote(body)
+	}
+	return "`" + body + "`"
+}
+
+func isExported(name string) bool {
+	r, _ := utf8.DecodeRuneInString(name)
+	return unicode.IsUpper(r)
+}
+
+func upperFirst(name string) string {
+	r, size := utf8.DecodeRuneInString(name)
+	return string(unicode.ToUpper(r)) + name[size:]
+}
+
+func lowerFirst(name string) string {
+	r, size := utf8.DecodeRuneInString(name)
+	return string(unicode.ToLower(r)) + name[size:]
+}
@@ -0,0 +1,717 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/importer"
+	goparser "go/parser"
+	"go/token"
+	"go/types"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestGenerate(t *testing.T) {
+	text := builtinType("text")
+	int8 := builtinType("int8")
+	address := &resolvedType{
+		kind:     typeComposite,
+		postgres: "address",
+		goType:   "Address",
+		composite: &compositeType{
+			postgres: "address",
+			goName:   "Address",
+			fields: []compositeField{
+				{name: "street", goName: "Street", typ: text, notNull: true},
+				{name: "city", goName: "City", typ: text},
+			},
+		},
+	}
+	queries := []query{
+		{
+			resultKind:  resultStruct,
+			resultCount: resultOption,
+			structName:  "Person",
+			body:        "select id, name, address from person where id = $1",
+			parameters:  []parameter{{name: "id", typ: int8, notNull: true}},
+			fields: []field{
+				{name: "id", typ: int8, notNull: true},
+				{name: "name", typ: text},
+				{name: "address", typ: address},
+			},
+		},
+		{
+			resultKind:  resultDirect,
+			resultCount: resultMany,
+			funcName:    "ListTags",
+			body:        "select tags from person",
+			fields: []field{
+				{name: "tags", typ: &resolvedType{
+					kind:      typeArray,
+					postgres:  "_text",
+					goType:    "[]string",
+					elem:      text,
+					delimiter: ',',
+				}, notNull: true},
+			},
+		},
+		{
+			resultKind: resultNone,
+			funcName:   "SetAddress",
+			body:       "update person set address = $2 where id = $1",
+			parameters: []parameter{
+				{name: "id", typ: int8, notNull: true},
+				{name: "address", typ: address},
+			},
+		},
+	}
+	source, err := generate("queries", nil, queries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{
+		"func GetPerson(c *postgres.Conn, id int64) (Person, bool, error) {",
+		"func ListTags(c *postgres.Conn) ([][]string, error) {",
+		"func SetAddress(c *postgres.Conn, id int64, address *Address) error {",
+		"postgres.PointerValue(address, appendAddress)",
+		"func decodeAddress(format int, b []byte) (Address, error) {",
+		"\tCity   *string\n",
+	} {
+		if !strings.Contains(string(source), expected) {
+			t.Fatalf("missing %q in:\n%s", expected, source)
+		}
+	}
+
+	queries = append(queries, query{
+		resultKind:  resultStruct,
+		resultCount: resultOne,
+		structName:  "Person",
+		body:        "select 1 as id",
+		fields:      []field{{name: "id", typ: int8, notNull: true}},
+	})
+	if _, err := generate("queries", nil, queries); err == nil {
+		t.Fatal("expected duplicate declaration error")
+	}
+}
+
+func TestGenerateEnum(t *testing.T) {
+	status := &resolvedType{
+		kind:     typeEnum,
+		postgres: "order_status",
+		goType:   "OrderStatus",
+		enum: &enumType{
+			postgres: "order_status",
+			goName:   "OrderStatus",
+			labels:   []string{"pending", "in progress", "done"},
+		},
+	}
+	queries := []query{{
+		resultKind:  resultDirect,
+		resultCount: resultOne,
+		funcName:    "GetStatus",
+		body:        "select status from orders where status <> $1",
+		parameters:  []parameter{{typ: status, notNull: true}},
+		fields:      []field{{name: "status", typ: status, notNull: true}},
+	}}
+	source, err := generate("queries", nil, queries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{
+		"type OrderStatus string",
+		"\tOrderStatusInProgress OrderStatus = \"in progress\"\n",
+		"case OrderStatusPending, OrderStatusInProgress, OrderStatusDone:",
+		"postgres.DecodeEnum(format, b, \"order_status\", OrderStatus.Valid)",
+	} {
+		if !strings.Contains(string(source), expected) {
+			t.Fatalf("missing %q in:\n%s", expected, source)
+		}
+	}
+
+	status.enum.labels = []string{"+", "-"}
+	source, err = generate("queries", nil, queries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(source), "OrderStatusLabel2 OrderStatus = \"-\"") {
+		t.Fatalf("missing indexed constant name in:\n%s", source)
+	}
+
+	status.enum.labels = []string{"pending", "in progress", "in-progress"}
+	if _, err := generate("queries", nil, queries); err == nil {
+		t.Fatal("expected duplicate constant error")
+	}
+}
+
+func TestGenerateDomain(t *testing.T) {
+	email := &resolvedType{
+		kind:     typeDomain,
+		postgres: "email",
+		goType:   "Email",
+		domain: &domainType{
+			postgres: "email",
+			goName:   "Email",
+			base:     builtinType("text"),
+		},
+	}
+	queries := []query{{
+		resultKind:  resultDirect,
+		resultCount: resultMany,
+		funcName:    "ListEmails",
+		body:        "select email from users where email like $1",
+		parameters:  []parameter{{typ: email, notNull: true}},
+		fields:      []field{{name: "email", typ: email, notNull: true}},
+	}}
+	source, err := generate("queries", nil, queries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{
+		"type Email string",
+		"func ListEmails(c *postgres.Conn, p1 Email) ([]Email, error) {",
+		"return postgres.AppendString(b, string(v))",
+	} {
+		if !strings.Contains(string(source), expected) {
+			t.Fatalf("missing %q in:\n%s", expected, source)
+		}
+	}
+}
+
+func builtinType(name string) *resolvedType {
+	return newScalarType(pgType{namespace: pgCatalog, name: name, kind: pgTypeKindBase}, "")
+}
+
+func TestGenerateConverted(t *testing.T) {
+	int8 := builtinType("int8")
+	tags := &resolvedType{
+		kind:      typeArray,
+		postgres:  "_text",
+		goType:    "[]string",
+		elem:      builtinType("text"),
+		delimiter: ',',
+	}
+	queries := []query{{
+		resultKind:  resultDirect,
+		resultCount: resultOne,
+		funcName:    "GetTags",
+		body:        "select id, tags from person where id = $1",
+		parameters:  []parameter{{typ: withGoType(int8, "example.com/person.ID"), notNull: true}},
+		fields: []field{
+			{name: "id", typ: withGoType(int8, "int"), notNull: true},
+			{name: "tags", typ: withGoType(tags, "example.com/person.Tags"), notNull: true},
+		},
+	}}
+	source, err := generate("queries", nil, queries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{
+		"func GetTags(c *postgres.Conn, p1 person.ID) (int, person.Tags, error) {",
+		"postgres.Value(p1, appendInt8AsPersonID)",
+		"postgres.ScanField(c, 0, postgres.DecodeInt)",
+		"func decodeTextAsPersonTags(format int, b []byte) (person.Tags, error) {",
+		"v, err := postgres.ArrayDecoder(',', postgres.DecodeString)(format, b)",
+	} {
+		if !strings.Contains(string(source), expected) {
+			t.Fatalf("missing %q in:\n%s", expected, source)
+		}
+	}
+}
+
+func TestGenerateNullable(t *testing.T) {
+	withNullable := func(name string, nullable nullableStrategy) *resolvedType {
+		typ := builtinType(name)
+		typ.nullable = nullable
+		return typ
+	}
+	queries := []query{{
+		resultKind:  resultStruct,
+		resultCount: resultMany,
+		structName:  "Nullable",
+		body:        "select a, b, c, d, e",
+		fields: []field{
+			{name: "a", typ: withNullable("text", nullablePointer)},
+			{name: "b", typ: withNullable("text", nullableGeneric)},
+			{name: "c", typ: withNullable("timestamptz", nullableSQL)},
+			{name: "d", typ: withNullable("uuid", nullableSQL)},
+			{name: "e", typ: withGoType(withNullable("numeric", nullablePointer), "*math/big.Rat")},
+		},
+	}}
+	source, err := generate("queries", nil, queries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{
+		"\tA *string\n",
+		"\tB postgres.Null[string]\n",
+		"\tC sql.NullTime\n",
+		"\tD *[16]byte\n",
+		"\tE *big.Rat\n",
+		"v.B = postgres.Null[string]{V: x, Valid: true}",
+		"v.C = sql.NullTime{Time: x, Valid: true}",
+		"v.E = x",
+	} {
+		if !strings.Contains(string(source), expected) {
+			t.Fatalf("missing %q in:\n%s", expected, source)
+		}
+	}
+}
+
+func TestGenerateParameterNames(t *testing.T) {
+	int8 := builtinType("int8")
+	queries := []query{{
+		resultKind: resultNone,
+		funcName:   "Names",
+		body:       "select $1, $2, $3, $4, $5, $6, $7",
+		parameters: []parameter{
+			{name: "user_id", typ: int8, notNull: true},
+			{name: "type", typ: int8, notNull: true},
+			{name: "c", typ: int8, notNull: true},
+			{typ: int8, notNull: true},
+			{name: "p6", typ: int8, notNull: true},
+			{name: "x y", typ: int8, notNull: true},
+			{name: "query_names", typ: int8, notNull: true},
+		},
+	}}
+	source, err := generate("queries", nil, queries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "func Names(c *postgres.Conn, userID int64, typeArg int64, cArg int64, p4 int64, p5 int64, p6 int64, queryNamesArg int64) error {"
+	if !strings.Contains(string(source), expected) {
+		t.Fatalf("missing %q in:\n%s", expected, source)
+	}
+}
+
+func TestGenerateInputStruct(t *testing.T) {
+	text, timestamptz := builtinType("text"), builtinType("timestamptz")
+	queries := []query{
+		{
+			resultKind:  resultNone,
+			funcName:    "InsertPerson",
+			inputStruct: "NewPerson",
+			body:        "insert into person (name, created_at) values ($1, $2)",
+			parameters: []parameter{
+				{name: "name", typ: text, notNull: true},
+				{name: "created_at", typ: timestamptz},
+			},
+		},
+		{
+			resultKind:  resultNone,
+			funcName:    "UpdatePerson",
+			inputStruct: "example.com/person.Update",
+			body:        "update person set name = $1 where created_at = $2",
+			parameters: []parameter{
+				{name: "name", typ: text, notNull: true, goName: "FullName"},
+				{name: "created_at", typ: timestamptz},
+			},
+		},
+	}
+	source, err := generate("queries", nil, queries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{
+		"type NewPerson struct {\n\tName      string\n\tCreatedAt *time.Time\n}",
+		"func InsertPerson(c *postgres.Conn, in NewPerson) error {",
+		"postgres.Value(in.Name, postgres.AppendString)",
+		"postgres.PointerValue(in.CreatedAt, postgres.AppendTimestamp)",
+		"func UpdatePerson(c *postgres.Conn, in person.Update) error {",
+		"postgres.Value(in.FullName, postgres.AppendString)",
+	} {
+		if !strings.Contains(string(source), expected) {
+			t.Fatalf("missing %q in:\n%s", expected, source)
+		}
+	}
+}
+
+func TestGenerateNested(t *testing.T) {
+	int8, text := builtinType("int8"), builtinType("text")
+	fields := []field{
+		{name: "id", typ: int8, notNull: true, table: "person", alias: "p"},
+		{name: "name", typ: text, notNull: true, table: "person", alias: "p"},
+		{name: "count", typ: int8, notNull: true},
+		{name: "name", typ: text, table: "person", alias: "friend"},
+	}
+	groupFields(fields)
+	queries := []query{{
+		resultKind:  resultStruct,
+		resultCount: resultOne,
+		structName:  "NameAndFriendName",
+		body:        "select p.id, p.name, 1::int8 as count, friend.name from person p left join person friend on friend.id = p.friend_id",
+		fields:      fields,
+	}}
+	source, err := generate("queries", nil, queries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{
+		"type NameAndFriendName struct {\n\tP struct {\n\t\tID   int64\n\t\tName string\n\t}\n\tCount  int64\n\tFriend struct {\n\t\tName *string\n\t}\n}",
+		"v.P.ID, err = postgres.ScanField(c, 0, postgres.DecodeInt64)",
+		"v.Friend.Name = &x",
+	} {
+		if !strings.Contains(string(source), expected) {
+			t.Fatalf("missing %q in:\n%s", expected, source)
+		}
+	}
+
+	fields = []field{
+		{name: "id", typ: int8, table: "person", alias: "p"},
+		{name: "id", typ: int8, table: "address"},
+	}
+	groupFields(fields)
+	if fields[0].group != "person" || fields[1].group != "address" {
+		t.Fatalf("got groups %q and %q", fields[0].group, fields[1].group)
+	}
+}
+
+func TestGenerateTable(t *testing.T) {
+	int8, text := builtinType("int8"), builtinType("text")
+	person := &tableType{
+		schema: "public",
+		name:   "person",
+		goName: "Person",
+		fields: []field{
+			{name: "id", typ: int8, notNull: true, table: "person"},
+			{name: "name", typ: text, table: "person"},
+		},
+	}
+	queries := []query{{
+		resultKind:  resultStruct,
+		resultCount: resultMany,
+		funcName:    "ListPersons",
+		structName:  "Person",
+		body:        "select id, name from person",
+		fields:      person.fields,
+	}}
+	source, err := generate("queries", []*tableType{person}, queries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{
+		"// Person is a row of public.person.\ntype Person struct {\n\tID   int64\n\tName *string\n}",
+		"func ListPersons(c *postgres.Conn) ([]Person, error) {",
+	} {
+		if !strings.Contains(string(source), expected) {
+			t.Fatalf("missing %q in:\n%s", expected, source)
+		}
+	}
+
+	queries[0].fields = queries[0].fields[:1]
+	if _, err := generate("queries", []*tableType{person}, queries); err == nil {
+		t.Fatal("expected error for different columns")
+	}
+}
+
+func TestGeneratePackage(t *testing.T) {
+	int8, timestamptz := builtinType("int8"), builtinType("timestamptz")
+	person := &tableType{
+		schema: "public",
+		name:   "person",
+		goName: "Person",
+		fields: []field{
+			{name: "id", typ: int8, notNull: true, table: "person"},
+			{name: "created", typ: timestamptz, notNull: true, table: "person"},
+		},
+	}
+	status := &resolvedType{
+		kind:     typeEnum,
+		postgres: "status",
+		goType:   "Status",
+		enum:     &enumType{postgres: "status", goName: "Status", labels: []string{"active"}},
+	}
+	getPerson := func(funcName string) query {
+		return query{
+			resultKind:  resultStruct,
+			resultCount: resultOne,
+			funcName:    funcName,
+			structName:  "Person",
+			body:        "select id, created from person where status = $1",
+			parameters:  []parameter{{typ: status, notNull: true}},
+			fields:      person.fields,
+		}
+	}
+
+	decls := newPackageDecls()
+	first, err := decls.generate("queries", []*tableType{person}, []query{getPerson("GetPerson")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := decls.generate("queries", nil, []query{getPerson("GetActivePerson")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, declaration := range []string{"type Person struct", "type Status string", "func scanPerson("} {
+		if !strings.Contains(string(first), declaration) {
+			t.Fatalf("missing %q in the first file:\n%s", declaration, first)
+		}
+		if strings.Contains(string(second), declaration) {
+			t.Fatalf("%q is declared again in the second file:\n%s", declaration, second)
+		}
+	}
+	if !strings.Contains(string(second), "func GetActivePerson(") {
+		t.Fatalf("missing GetActivePerson in the second file:\n%s", second)
+	}
+	// time is only used by the struct in the first file
+	if strings.Contains(string(second), `"time"`) {
+		t.Fatalf("unused import in the second file:\n%s", second)
+	}
+}
+
+func TestGenerateExistingStruct(t *testing.T) {
+	text := builtinType("text")
+	nickname := *text
+	nickname.nullable = nullableGeneric
+	queries := []query{{
+		resultKind:  resultStruct,
+		resultCount: resultOne,
+		funcName:    "GetUser",
+		structName:  "example.com/app/models.User",
+		body:        "select name, nickname from users",
+		fields: []field{
+			{name: "name", typ: text, notNull: true, goName: "Name"},
+			{name: "nickname", typ: &nickname, goName: "Nick"},
+		},
+	}}
+	source, err := generate("queries", nil, queries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{
+		"func GetUser(c *postgres.Conn) (models.User, error) {",
+		"func scanModelsUser(c *postgres.Conn) (models.User, error) {",
+		"v.Nick = postgres.Null[string]{V: x, Valid: true}",
+	} {
+		if !strings.Contains(string(source), expected) {
+			t.Fatalf("missing %q in:\n%s", expected, source)
+		}
+	}
+	if strings.Contains(string(source), "type User") {
+		t.Fatalf("unexpected struct declaration in:\n%s", source)
+	}
+}
+
+func TestGenerateDoc(t *testing.T) {
+	int8, text := builtinType("int8"), builtinType("text")
+	fields := []field{{name: "id", typ: int8, notNull: true}, {name: "name", typ: text}}
+	queries := []query{
+		{
+			resultKind:  resultStruct,
+			resultCount: resultOne,
+			funcName:    "GetPerson",
+			structName:  "Person",
+			body:        "select id, name from person where id = $1",
+			doc:         []string{"GetPerson returns a person by id.", "", "Deleted persons are included."},
+			text:        "select id, name\nfrom person\n\nwhere id = @id",
+			parameters:  []parameter{{name: "id", typ: int8, notNull: true}},
+			fields:      fields,
+		},
+		{
+			resultKind:  resultStruct,
+			resultCount: resultMany,
+			funcName:    "ListPersons",
+			structName:  "Person",
+			body:        "select id, name from person",
+			fields:      fields,
+		},
+	}
+	source, err := generate("queries", nil, queries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{
+		"// GetPerson returns a person by id.\n//\n// Deleted persons are included.\n//\n" +
+			"//\tselect id, name\n//\tfrom person\n//\n//\twhere id = @id\nfunc GetPerson(",
+		"// Person is the result of GetPerson.\n//\n// GetPerson returns a person by id.\n",
+		"// ListPersons runs the query:\n//\n//\tselect id, name from person\nfunc ListPersons(",
+	} {
+		if !strings.Contains(string(source), expected) {
+			t.Fatalf("missing %q in:\n%s", expected, source)
+		}
+	}
+}
+
+const typeCheckModels = `package models
+
+type ID int64
+
+type Tags []string
+
+type NewUser struct {
+	Name     string
+	Nickname *string ` + "`sql:\"nick\"`" + `
+}
+`
+
+// typeCheck parses and type checks the generated files of a package,
+// the imports are loaded from the module in dir.
+func typeCheck(t *testing.T, dir string, sources ...[]byte) {
+	fset := token.NewFileSet()
+	var files []*ast.File
+	args := []string{"list", "-export", "-deps", "-json=ImportPath,Export"}
+	for i, source := range sources {
+		file, err := goparser.ParseFile(fset, fmt.Sprintf("queries%d.gen.go", i), source, 0)
+		if err != nil {
+			t.Fatalf("%v in:\n%s", err, source)
+		}
+		for _, spec := range file.Imports {
+			importPath, _ := strconv.Unquote(spec.Path.Value)
+			args = append(args, importPath)
+		}
+		files = append(files, file)
+	}
+
+	cmd := exec.Command("go", args...)
+	cmd.Dir = dir
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("go list: %v", err)
+	}
+	exports := make(map[string]string)
+	dec := json.NewDecoder(bytes.NewReader(out))
+	for {
+		var listed struct{ ImportPath, Export string }
+		if err := dec.Decode(&listed); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		exports[listed.ImportPath] = listed.Export
+	}
+
+	config := types.Config{
+		Importer: importer.ForCompiler(fset, "gc", func(path string) (io.ReadCloser, error) {
+			return os.Open(exports[path])
+		}),
+	}
+	if _, err := config.Check("queries", fset, files, nil); err != nil {
+		t.Fatalf("%v in:\n%s", err, bytes.Join(sources, []byte("\n")))
+	}
+}
+
+func TestGenerateTypeCheck(t *testing.T) {
+	dir := writeTestModule(t, map[string]string{"models/models.go": typeCheckModels})
+
+	int8, text, timestamptz := builtinType("int8"), builtinType("text"), builtinType("timestamptz")
+	withNullable := func(name string, nullable nullableStrategy) *resolvedType {
+		typ := builtinType(name)
+		typ.nullable = nullable
+		return typ
+	}
+	tags := &resolvedType{kind: typeArray, postgres: "_text", goType: "[]string", elem: text, delimiter: ','}
+	status := &resolvedType{
+		kind:     typeEnum,
+		postgres: "status",
+		goType:   "Status",
+		enum:     &enumType{postgres: "status", goName: "Status", labels: []string{"in progress", "-", "+"}},
+	}
+	address := &resolvedType{
+		kind:     typeComposite,
+		postgres: "address",
+		goType:   "Address",
+		composite: &compositeType{
+			postgres: "address",
+			goName:   "Address",
+			fields: []compositeField{
+				{name: "street", goName: "Street", typ: text, notNull: true},
+				{name: "status", goName: "Status", typ: status},
+			},
+		},
+	}
+	email := &resolvedType{
+		kind:     typeDomain,
+		postgres: "email",
+		goType:   "Email",
+		domain:   &domainType{postgres: "email", goName: "Email", base: text},
+	}
+	person := &tableType{
+		schema: "public",
+		name:   "person",
+		goName: "Person",
+		fields: []field{
+			{name: "id", typ: int8, notNull: true, table: "person"},
+			{name: "email", typ: email, table: "person"},
+			{name: "address", typ: address, table: "person"},
+		},
+	}
+
+	first := []query{
+		{
+			resultKind:  resultStruct,
+			resultCount: resultOption,
+			structName:  "Person",
+			body:        "select id, email, address from person where id = $1 and status = $2",
+			parameters: []parameter{
+				{name: "query_get_person", typ: withGoType(int8, "example.com/app/models.ID"), notNull: true},
+				{name: "status", typ: status, notNull: true},
+			},
+			fields: person.fields,
+		},
+		{
+			resultKind:  resultStruct,
+			resultCount: resultMany,
+			funcName:    "ListConverted",
+			structName:  "Converted",
+			body:        "select id, tags, a, b, c, d",
+			fields: []field{
+				{name: "id", typ: withGoType(int8, "int"), notNull: true},
+				{name: "tags", typ: withGoType(tags, "example.com/app/models.Tags"), notNull: true},
+				{name: "a", typ: withNullable("text", nullablePointer)},
+				{name: "b", typ: withNullable("text", nullableGeneric)},
+				{name: "c", typ: withNullable("timestamptz", nullableSQL)},
+				{name: "d", typ: withGoType(withNullable("numeric", nullablePointer), "*math/big.Rat")},
+			},
+		},
+	}
+	second := []query{
+		{
+			resultKind:  resultNone,
+			funcName:    "InsertPerson",
+			inputStruct: "NewPerson",
+			body:        "insert into person (email, address, created_at) values ($1, $2, $3)",
+			parameters: []parameter{
+				{name: "email", typ: email, notNull: true},
+				{name: "address", typ: address},
+				{name: "created_at", typ: timestamptz},
+			},
+		},
+		{
+			resultKind:  resultNone,
+			funcName:    "InsertUser",
+			inputStruct: "example.com/app/models.NewUser",
+			body:        "insert into users (name, nickname) values ($1, $2)",
+			parameters: []parameter{
+				{name: "name", typ: text, notNull: true, goName: "Name"},
+				{name: "nick", typ: text, goName: "Nickname"},
+			},
+		},
+		{
+			resultKind:  resultDirect,
+			resultCount: resultOption,
+			funcName:    "GetStatus",
+			body:        "select status, address from person where email = $1",
+			parameters:  []parameter{{name: "append_email", typ: email, notNull: true}},
+			fields: []field{
+				{name: "status", typ: status, notNull: true},
+				{name: "address", typ: address},
+			},
+		},
+	}
+
+	decls := newPackageDecls()
+	firstSource, err := decls.generate("queries", []*tableType{person}, first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secondSource, err := decls.generate("queries", nil, second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	typeCheck(t, dir, firstSource, secondSource)
+}
@@ -3,8 +3,13 @@ module github.com/erikfastermann/sql
 go 1.19
 
 require (
-	github.com/xdg-go/pbkdf2 v1.0.0 // indirect
+	github.com/BurntSushi/toml v1.3.2
 	github.com/xdg-go/scram v1.1.2
+	golang.org/x/text v0.3.8
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require (
+	github.com/xdg-go/pbkdf2 v1.0.0 // indirect
 	github.com/xdg-go/stringprep v1.0.4 // indirect
-	golang.org/x/text v0.3.8 // indirect
 )
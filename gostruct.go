@@ -0,0 +1,419 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/importer"
+	"go/token"
+	"go/types"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Declarations can use an existing Go struct as their result
+// (e.g. GetUser -> example.com/app/models.User). The package is loaded
+// with go/types, columns are matched to the exported fields
+// by the sql tag or by name (case insensitive). Fields tagged
+// with sql:"-" are ignored.
+
+var errNotStruct = errors.New("not a struct type")
+
+// isGoTypeReference reports if the struct name of a declaration
+// references an existing Go type.
+func isGoTypeReference(structName string) bool {
+	return strings.Contains(structName, ".")
+}
+
+func (b *builder) lookupGoStruct(typ string) (*types.Struct, error) {
+	dot := strings.LastIndexByte(typ, '.')
+	importPath, name := typ[:dot], typ[dot+1:]
+
+	pkg, err := b.importGoPackage(importPath)
+	if err != nil {
+		return nil, err
+	}
+	obj := pkg.Scope().Lookup(name)
+	if obj == nil {
+		return nil, fmt.Errorf("%s not found in package %s", name, importPath)
+	}
+	if _, ok := obj.(*types.TypeName); !ok {
+		return nil, fmt.Errorf("%s: not a type", typ)
+	}
+	structType, ok := obj.Type().Underlying().(*types.Struct)
+	if !ok {
+		return nil, fmt.Errorf("%s: %w", typ, errNotStruct)
+	}
+	return structType, nil
+}
+
+// goCommandDir returns the directory of the output file or the
+// closest parent which exists, the go command uses its module.
+func goCommandDir(output string) string {
+	dir := filepath.Dir(output)
+	for {
+		// the output directory might not exist yet
+		if _, err := os.Stat(dir); err == nil || filepath.Dir(dir) == dir {
+			return dir
+		}
+		dir = filepath.Dir(dir)
+	}
+}
+
+// importGoPackage type checks the package with the export data of
+// the go command, run in the directory of the output file
+// to use the module of the generated code.
+func (b *builder) importGoPackage(importPath string) (*types.Package, error) {
+	if pkg, ok := b.goPackages[importPath]; ok {
+		return pkg, nil
+	}
+
+	cmd := exec.Command("go", "list", "-export", "-deps", "-json=ImportPath,Export,Error", importPath)
+	cmd.Dir = goCommandDir(b.file.output)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("go list %s: %w: %s", importPath, err, bytes.TrimSpace(stderr.Bytes()))
+	}
+
+	exports := make(map[string]string)
+	dec := json.NewDecoder(bytes.NewReader(out))
+	for {
+		var listed struct {
+			ImportPath string
+			Export     string
+			Error      *struct{ Err string }
+		}
+		if err := dec.Decode(&listed); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		if listed.Error != nil {
+			return nil, fmt.Errorf("go list %s: %s", listed.ImportPath, listed.Error.Err)
+		}
+		exports[listed.ImportPath] = listed.Export
+	}
+
+	imp := importer.ForCompiler(token.NewFileSet(), "gc", func(path string) (io.ReadCloser, error) {
+		export, ok := exports[path]
+		if !ok || export == "" {
+			return nil, fmt.Errorf("no export data for %s", path)
+		}
+		return os.Open(export)
+	})
+	pkg, err := imp.Import(importPath)
+	if err != nil {
+		return nil, err
+	}
+	if b.goPackages == nil {
+		b.goPackages = make(map[string]*types.Package)
+	}
+	b.goPackages[importPath] = pkg
+	return pkg, nil
+}
+
+// matchGoStruct sets the Go field names of the fields and
+// uses the Go types of the struct fields for decoding.
+func (b *builder) matchGoStruct(typ string, fields []field) error {
+	structType, err := b.lookupGoStruct(typ)
+	if err != nil {
+		return err
+	}
+
+	assigned := make([]bool, structType.NumFields())
+	for i := range fields {
+		f := &fields[i]
+		if f.group != "" {
+			return fmt.Errorf("%s: nested is not supported with existing structs", typ)
+		}
+		index := -1
+		for j := 0; j < structType.NumFields(); j++ {
+			if matchesColumn(structType, j, f.name) {
+				index = j
+				break
+			}
+		}
+		if index < 0 {
+			return fmt.Errorf("%s: no field for column %q", typ, f.name)
+		}
+		if assigned[index] {
+			return fmt.Errorf("%s: field %s is used by multiple columns", typ, structType.Field(index).Name())
+		}
+		assigned[index] = true
+
+		goField := structType.Field(index)
+		f.goName = goField.Name()
+		f.typ, err = b.goFieldType(f.typ, f.notNull, goField.Type(), false)
+		if err != nil {
+			return fmt.Errorf("%s: field %s (column %q): %w", typ, goField.Name(), f.name, err)
+		}
+	}
+
+	for j := 0; j < structType.NumFields(); j++ {
+		goField := structType.Field(j)
+		if !assigned[j] && goField.Exported() && reflect.StructTag(structType.Tag(j)).Get("sql") != "-" {
+			return fmt.Errorf("%s: field %s is not set by the query", typ, goField.Name())
+		}
+	}
+	return nil
+}
+
+// matchGoInputStruct sets the Go field names of the parameters
+// and checks the types of the fields. Fields which are not
+// used by a parameter are ignored.
+func (b *builder) matchGoInputStruct(typ string, parameters []parameter) error {
+	structType, err := b.lookupGoStruct(typ)
+	if err != nil {
+		return err
+	}
+	for i := range parameters {
+		p := &parameters[i]
+		index := -1
+		for j := 0; j < structType.NumFields(); j++ {
+			if matchesColumn(structType, j, p.name) {
+				index = j
+				break
+			}
+		}
+		if index < 0 {
+			return fmt.Errorf("%s: no field for parameter %q", typ, p.name)
+		}
+		goField := structType.Field(index)
+		p.goName = goField.Name()
+		p.typ, err = b.goFieldType(p.typ, p.notNull, goField.Type(), true)
+		if err != nil {
+			return fmt.Errorf("%s: field %s (parameter %q): %w", typ, goField.Name(), p.name, err)
+		}
+	}
+	return nil
+}
+
+func matchesColumn(structType *types.Struct, index int, column string) bool {
+	goField := structType.Field(index)
+	if !goField.Exported() {
+		return false
+	}
+	tag, ok := reflect.StructTag(structType.Tag(index)).Lookup("sql")
+	if ok {
+		return tag == column
+	}
+	return strings.EqualFold(goField.Name(), exportedName(column))
+}
+
+var errGoFieldNotNullable = errors.New(
+	"column is nullable, expected a pointer, postgres.Null or a database/sql.Null type",
+)
+
+// goFieldType converts typ to the type of the struct field,
+// for nullable columns the Go type also sets the nullable strategy.
+// The values of parameters are converted from the field to the column type.
+func (b *builder) goFieldType(
+	typ *resolvedType,
+	notNull bool,
+	goFieldType types.Type,
+	parameter bool,
+) (*resolvedType, error) {
+	goTypeString := func(t types.Type) (string, error) {
+		s := types.TypeString(t, func(p *types.Package) string { return p.Path() })
+		if !goTypeMatcher.MatchString(s) {
+			return "", fmt.Errorf("unsupported Go type %s", s)
+		}
+		return s, nil
+	}
+
+	if notNull {
+		goType, err := goTypeString(goFieldType)
+		if err != nil {
+			return nil, err
+		}
+		if err := b.checkColumnGoType(typ, goFieldType, parameter); err != nil {
+			return nil, err
+		}
+		return withGoType(typ, goType), nil
+	}
+
+	var elem types.Type
+	var strategy nullableStrategy
+	switch t := goFieldType.(type) {
+	case *types.Pointer:
+		if goType, err := goTypeString(t); err == nil && goType == typ.goType {
+			// already a pointer, e.g. *big.Rat
+			elem = t
+		} else {
+			elem = t.Elem()
+		}
+		strategy = nullablePointer
+	case *types.Named:
+		obj := t.Obj()
+		switch {
+		case obj.Pkg() != nil && obj.Pkg().Path() == runtimePackage && obj.Name() == "Null" && t.TypeArgs().Len() == 1:
+			elem = t.TypeArgs().At(0)
+			strategy = nullableGeneric
+		case obj.Pkg() != nil && obj.Pkg().Path() == "database/sql":
+			for goType, nullType := range sqlNullTypes {
+				if nullType.name != obj.Name() {
+					continue
+				}
+				if goType != typ.goType {
+					return nil, fmt.Errorf("sql.%s can not hold %s", nullType.name, typ.goType)
+				}
+				converted := *typ
+				converted.nullable = nullableSQL
+				return &converted, nil
+			}
+		}
+	}
+	if elem == nil {
+		return nil, errGoFieldNotNullable
+	}
+	goType, err := goTypeString(elem)
+	if err != nil {
+		return nil, err
+	}
+	if err := b.checkColumnGoType(typ, elem, parameter); err != nil {
+		return nil, err
+	}
+	converted := *withGoType(typ, goType)
+	converted.nullable = strategy
+	return &converted, nil
+}
+
+var errGeneratedGoType = errors.New("type is generated")
+
+// checkColumnGoType reports if the decoded value of the column
+// can not be converted to the Go type of the field,
+// or for parameters the field to the encoded value.
+func (b *builder) checkColumnGoType(typ *resolvedType, goFieldType types.Type, parameter bool) error {
+	needs := "column needs"
+	if parameter {
+		needs = "parameter needs"
+	}
+	columnType, err := b.columnGoType(typ)
+	if errors.Is(err, errGeneratedGoType) {
+		return fmt.Errorf("has type %s, %s the generated type %s", qualifiedTypeString(goFieldType), needs, typ.goType)
+	}
+	if err != nil {
+		return err
+	}
+	convertible := convertibleGoType(columnType, goFieldType)
+	if parameter {
+		convertible = convertibleGoType(goFieldType, columnType)
+	}
+	if !convertible {
+		return fmt.Errorf("has type %s, %s %s", qualifiedTypeString(goFieldType), needs, qualifiedTypeString(columnType))
+	}
+	return nil
+}
+
+func qualifiedTypeString(t types.Type) string {
+	return types.TypeString(t, (*types.Package).Name)
+}
+
+// columnGoType returns the Go type a column is decoded to, before it is
+// converted to the type of the field. Enums and domains are generated in
+// the output package, they are represented by their underlying type.
+func (b *builder) columnGoType(typ *resolvedType) (types.Type, error) {
+	switch typ.kind {
+	case typeScalar:
+		return b.lookupGoType(typ.codec.goType)
+	case typeEnum:
+		return types.Typ[types.String], nil
+	case typeDomain:
+		if typ.domain.base.kind == typeScalar {
+			return b.lookupGoType(typ.domain.base.goType)
+		}
+		return b.columnGoType(typ.domain.base)
+	default:
+		return b.lookupGoType(typ.goType)
+	}
+}
+
+// lookupGoType converts the format of TypeInfo.Go (e.g. []*math/big.Rat)
+// to the type, the package is loaded with go/types.
+func (b *builder) lookupGoType(goType string) (types.Type, error) {
+	switch {
+	case strings.HasPrefix(goType, "[]"):
+		elem, err := b.lookupGoType(goType[2:])
+		if err != nil {
+			return nil, err
+		}
+		return types.NewSlice(elem), nil
+	case strings.HasPrefix(goType, "*"):
+		elem, err := b.lookupGoType(goType[1:])
+		if err != nil {
+			return nil, err
+		}
+		return types.NewPointer(elem), nil
+	case strings.HasPrefix(goType, "["):
+		end := strings.IndexByte(goType, ']')
+		length, err := strconv.ParseInt(goType[1:end], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		elem, err := b.lookupGoType(goType[end+1:])
+		if err != nil {
+			return nil, err
+		}
+		return types.NewArray(elem, length), nil
+	}
+
+	dot := strings.LastIndexByte(goType, '.')
+	if dot < 0 {
+		if obj, ok := types.Universe.Lookup(goType).(*types.TypeName); ok {
+			return obj.Type(), nil
+		}
+		return nil, fmt.Errorf("%s: %w", goType, errGeneratedGoType)
+	}
+	pkg, err := b.importGoPackage(goType[:dot])
+	if err != nil {
+		return nil, err
+	}
+	obj, ok := pkg.Scope().Lookup(goType[dot+1:]).(*types.TypeName)
+	if !ok {
+		return nil, fmt.Errorf("%s: not a type", goType)
+	}
+	return obj.Type(), nil
+}
+
+// convertibleGoType reports if a value of the column type can be converted
+// to the field type without changing its meaning: the underlying types are
+// identical or the conversion widens an integer (with the same signedness)
+// or a float. Conversions like string(int64), int32(int64) or to a pointer
+// type are rejected.
+func convertibleGoType(column, field types.Type) bool {
+	column, field = column.Underlying(), field.Underlying()
+	if types.Identical(column, field) {
+		return true
+	}
+	columnBasic, ok := column.(*types.Basic)
+	if !ok {
+		return false
+	}
+	fieldBasic, ok := field.(*types.Basic)
+	if !ok {
+		return false
+	}
+	const numeric = types.IsInteger | types.IsFloat
+	if columnBasic.Info()&numeric == 0 {
+		return false
+	}
+	const kind = numeric | types.IsUnsigned
+	if columnBasic.Info()&kind != fieldBasic.Info()&kind {
+		return false
+	}
+	return basicSize(columnBasic) <= basicSize(fieldBasic)
+}
+
+// basicSize returns the size of numeric types in bytes,
+// int and uint are assumed to have 64 bits.
+func basicSize(t *types.Basic) int64 {
+	return types.SizesFor("gc", "amd64").Sizeof(t)
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"errors"
+	"go/types"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const modelsSource = `package models
+
+import "github.com/erikfastermann/sql/postgres"
+
+type ID int64
+
+type User struct {
+	ID       ID
+	Name     string
+	Nickname *string
+	Email    postgres.Null[string] ` + "`sql:\"mail\"`" + `
+	Cache    []byte ` + "`sql:\"-\"`" + `
+	internal int
+}
+
+type Account struct {
+	ID string
+}
+
+type Counter struct {
+	Count *int64
+}
+
+type Small struct {
+	Count int32
+}
+
+type NewUser struct {
+	Name     string
+	Nickname *string ` + "`sql:\"nick\"`" + `
+	Age      int64
+}
+`
+
+// writeTestModule writes the files to the module example.com/app,
+// which uses the runtime package of this repository.
+func writeTestModule(t *testing.T, files map[string]string) string {
+	root, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	goSum, err := os.ReadFile(filepath.Join(root, "go.sum"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	module := runtimePackage[:strings.LastIndexByte(runtimePackage, '/')]
+	files["go.mod"] = "module example.com/app\n\ngo 1.19\n\n" +
+		"require " + module + " v0.0.0\n\n" +
+		"replace " + module + " => " + root + "\n"
+	files["go.sum"] = string(goSum)
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestMatchGoStruct(t *testing.T) {
+	dir := writeTestModule(t, map[string]string{
+		"models/models.go":   modelsSource,
+		"queries/queries.go": "package queries\n",
+	})
+
+	int8, text := builtinType("int8"), builtinType("text")
+	newFields := func() []field {
+		return []field{
+			{name: "id", typ: int8, notNull: true},
+			{name: "name", typ: text, notNull: true},
+			{name: "nickname", typ: text},
+			{name: "mail", typ: text},
+		}
+	}
+	b := &builder{file: fileDirectives{output: filepath.Join(dir, "queries", "queries.gen.go")}}
+	fields := newFields()
+	if err := b.matchGoStruct("example.com/app/models.User", fields); err != nil {
+		t.Fatal(err)
+	}
+	expected := []struct {
+		goName   string
+		goType   string
+		nullable nullableStrategy
+	}{
+		{"ID", "example.com/app/models.ID", nullableDefault},
+		{"Name", "string", nullableDefault},
+		{"Nickname", "string", nullablePointer},
+		{"Email", "string", nullableGeneric},
+	}
+	for i, e := range expected {
+		f := fields[i]
+		if f.goName != e.goName || f.typ.goType != e.goType || f.typ.nullable != e.nullable {
+			t.Fatalf("field %d: got %s %s %d", i, f.goName, f.typ.goType, f.typ.nullable)
+		}
+	}
+
+	fields = newFields()[:3]
+	if err := b.matchGoStruct("example.com/app/models.User", fields); err == nil {
+		t.Fatal("expected error for unset field")
+	}
+
+	fields = newFields()
+	fields[3].name = "unknown"
+	if err := b.matchGoStruct("example.com/app/models.User", fields); err == nil {
+		t.Fatal("expected error for unknown column")
+	}
+
+	fields = newFields()
+	fields[1].notNull = false
+	if err := b.matchGoStruct("example.com/app/models.User", fields); !errors.Is(err, errGoFieldNotNullable) {
+		t.Fatalf("expected errGoFieldNotNullable, got %v", err)
+	}
+
+	// no conversion string(int64)
+	fields = []field{{name: "id", typ: int8, notNull: true}}
+	err := b.matchGoStruct("example.com/app/models.Account", fields)
+	if err == nil || !strings.Contains(err.Error(), "field ID (column \"id\"): has type string, column needs int64") {
+		t.Fatalf("expected type mismatch, got %v", err)
+	}
+
+	// not null columns are not converted to pointers
+	fields = []field{{name: "count", typ: int8, notNull: true}}
+	err = b.matchGoStruct("example.com/app/models.Counter", fields)
+	if err == nil || !strings.Contains(err.Error(), "has type *int64, column needs int64") {
+		t.Fatalf("expected type mismatch, got %v", err)
+	}
+	fields = []field{{name: "count", typ: int8}}
+	if err := b.matchGoStruct("example.com/app/models.Counter", fields); err != nil {
+		t.Fatal(err)
+	}
+	// no truncating conversion int32(int64)
+	fields = []field{{name: "count", typ: int8, notNull: true}}
+	err = b.matchGoStruct("example.com/app/models.Small", fields)
+	if err == nil || !strings.Contains(err.Error(), "has type int32, column needs int64") {
+		t.Fatalf("expected type mismatch, got %v", err)
+	}
+	fields = []field{{name: "count", typ: builtinType("int2"), notNull: true}}
+	if err := b.matchGoStruct("example.com/app/models.Small", fields); err != nil {
+		t.Fatal(err)
+	}
+
+	fields = []field{{name: "count", typ: text}}
+	err = b.matchGoStruct("example.com/app/models.Counter", fields)
+	if err == nil || !strings.Contains(err.Error(), "has type int64, column needs string") {
+		t.Fatalf("expected type mismatch, got %v", err)
+	}
+
+	parameters := []parameter{{name: "name", typ: text, notNull: true}, {name: "nick", typ: text}}
+	if err := b.matchGoInputStruct("example.com/app/models.NewUser", parameters); err != nil {
+		t.Fatal(err)
+	}
+	if parameters[0].goName != "Name" || parameters[1].goName != "Nickname" ||
+		parameters[1].typ.nullable != nullablePointer {
+		t.Fatalf("got %+v", parameters)
+	}
+	// no truncating conversion int32(int64)
+	parameters = []parameter{{name: "age", typ: builtinType("int4"), notNull: true}}
+	err = b.matchGoInputStruct("example.com/app/models.NewUser", parameters)
+	if err == nil || !strings.Contains(err.Error(), "field Age (parameter \"age\"): has type int64, parameter needs int32") {
+		t.Fatalf("expected type mismatch, got %v", err)
+	}
+	parameters = []parameter{{name: "email", typ: text, notNull: true}}
+	if err := b.matchGoInputStruct("example.com/app/models.NewUser", parameters); err == nil {
+		t.Fatal("expected error for unknown parameter")
+	}
+}
+
+func TestConvertibleGoType(t *testing.T) {
+	tests := []struct {
+		column, field types.BasicKind
+		expected      bool
+	}{
+		{types.Int16, types.Int64, true},
+		{types.Int64, types.Int, true},
+		{types.Float32, types.Float64, true},
+		{types.Int64, types.Int32, false},
+		{types.Float64, types.Float32, false},
+		{types.Int32, types.Uint64, false},
+		{types.Int64, types.Float64, false},
+		{types.Int64, types.String, false},
+	}
+	for _, tt := range tests {
+		column, field := types.Typ[tt.column], types.Typ[tt.field]
+		if got := convertibleGoType(column, field); got != tt.expected {
+			t.Fatalf("%s to %s: got %t, expected %t", column, field, got, tt.expected)
+		}
+	}
+}
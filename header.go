@@ -0,0 +1,343 @@
+package main
+
+import (
+	"fmt"
+	"go/token"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Grammar of the declaration header (after `--- `),
+// whitespace between tokens is ignored:
+//
+//	header  = names [ "<-" goType ] [ "(" options ")" ] [ "{" options "}" ] [ "nested" ]
+//	names   = identifier "->" edges | edges
+//	edges   = [ "!" | "#" ] goType [ "?" | "+" ]
+//	options = option { "," option }
+//	option  = key ":" [ "null" | "notnull" ] [ goType ]
+//	key     = "$" number | number | identifier | quoted identifier
+//	goType  = { "[]" | "[" number "]" | "*" } [ path "." ] identifier
+
+type headerTokenKind int
+
+const (
+	headerEnd    headerTokenKind = iota
+	headerWord                   // identifier, number or Go type name with a package path
+	headerQuoted                 // quoted identifier, text is unquoted
+	headerPunctuation
+)
+
+type headerToken struct {
+	kind   headerTokenKind
+	text   string
+	offset int // byte offset in the header
+}
+
+func (t headerToken) String() string {
+	switch t.kind {
+	case headerEnd:
+		return "end of header"
+	case headerQuoted:
+		return fmt.Sprintf("quoted identifier %q", t.text)
+	default:
+		return "`" + t.text + "`"
+	}
+}
+
+// headerError reports the position of an error in the header.
+type headerError struct {
+	offset int // byte offset in the header
+	msg    string
+	err    error // optional
+}
+
+func (e *headerError) Error() string {
+	if e.err != nil {
+		return e.msg + ": " + e.err.Error()
+	}
+	return e.msg
+}
+
+func (e *headerError) Unwrap() error {
+	return e.err
+}
+
+func isHeaderWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune("_./-", r)
+}
+
+func lexHeader(header string) ([]headerToken, error) {
+	var tokens []headerToken
+	i := 0
+	for i < len(header) {
+		r, size := utf8.DecodeRuneInString(header[i:])
+		start := i
+		switch {
+		case r == ' ' || r == '\t':
+			i += size
+			continue
+		case strings.HasPrefix(header[i:], "->"), strings.HasPrefix(header[i:], "<-"):
+			i += 2
+			tokens = append(tokens, headerToken{kind: headerPunctuation, text: header[start:i], offset: start})
+		case r == '"':
+			var text strings.Builder
+			i++
+			for {
+				end := strings.IndexByte(header[i:], '"')
+				if end < 0 {
+					return nil, &headerError{offset: start, msg: "unterminated quoted identifier"}
+				}
+				text.WriteString(header[i : i+end])
+				i += end + 1
+				if i < len(header) && header[i] == '"' {
+					text.WriteByte('"')
+					i++
+					continue
+				}
+				break
+			}
+			if text.Len() == 0 {
+				return nil, &headerError{offset: start, msg: "empty quoted identifier"}
+			}
+			tokens = append(tokens, headerToken{kind: headerQuoted, text: text.String(), offset: start})
+		case strings.ContainsRune("!#?+$(){},:[]*", r):
+			i += size
+			tokens = append(tokens, headerToken{kind: headerPunctuation, text: header[start:i], offset: start})
+		case isHeaderWordRune(r):
+			for i < len(header) {
+				r, size := utf8.DecodeRuneInString(header[i:])
+				if !isHeaderWordRune(r) || strings.HasPrefix(header[i:], "->") {
+					break
+				}
+				i += size
+			}
+			tokens = append(tokens, headerToken{kind: headerWord, text: header[start:i], offset: start})
+		default:
+			return nil, &headerError{offset: start, msg: fmt.Sprintf("unexpected character %q", r)}
+		}
+	}
+	tokens = append(tokens, headerToken{kind: headerEnd, offset: len(header)})
+	return tokens, nil
+}
+
+// headerAST is the syntax tree of a header,
+// names and types are not checked.
+type headerAST struct {
+	funcName   *headerToken // only set with `->`
+	prefix     string       // "!", "#" or empty
+	name       headerToken  // function or struct name
+	suffix     string       // "?", "+" or empty
+	input      *headerGoType
+	parameters []headerOption // nil if there is no parameter list
+	columns    []headerOption // nil if there is no column list
+	nested     bool
+}
+
+type headerGoType struct {
+	text   string // e.g. []*math/big.Rat
+	offset int
+}
+
+type headerOption struct {
+	key         headerToken
+	keyIsIndex  bool // $n for parameters, n for columns
+	nullability string
+	goType      *headerGoType
+}
+
+type headerParser struct {
+	tokens []headerToken
+	pos    int
+}
+
+func (p *headerParser) peek() headerToken {
+	return p.tokens[p.pos]
+}
+
+func (p *headerParser) next() headerToken {
+	t := p.tokens[p.pos]
+	if t.kind != headerEnd {
+		p.pos++
+	}
+	return t
+}
+
+func (p *headerParser) accept(punctuation string) bool {
+	t := p.peek()
+	if t.kind == headerPunctuation && t.text == punctuation {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *headerParser) expected(what string) error {
+	t := p.peek()
+	return &headerError{offset: t.offset, msg: fmt.Sprintf("expected %s, got %s", what, t)}
+}
+
+func parseHeaderAST(header string) (*headerAST, error) {
+	tokens, err := lexHeader(header)
+	if err != nil {
+		return nil, err
+	}
+	p := &headerParser{tokens: tokens}
+	ast := &headerAST{}
+
+	if t := p.peek(); t.kind == headerWord && p.tokens[p.pos+1].text == "->" {
+		if !token.IsIdentifier(t.text) {
+			return nil, &headerError{offset: t.offset, msg: fmt.Sprintf("expected a function name, got %s", t)}
+		}
+		p.next()
+		p.next()
+		ast.funcName = &t
+	}
+
+	switch {
+	case p.accept("!"):
+		ast.prefix = "!"
+	case p.accept("#"):
+		ast.prefix = "#"
+	}
+	if p.peek().kind != headerWord {
+		if ast.funcName != nil {
+			return nil, p.expected("a struct name")
+		}
+		return nil, p.expected("a name")
+	}
+	ast.name = p.next()
+	switch {
+	case p.accept("?"):
+		ast.suffix = "?"
+	case p.accept("+"):
+		ast.suffix = "+"
+	}
+
+	if p.accept("<-") {
+		if ast.input, err = p.goType(); err != nil {
+			return nil, err
+		}
+	}
+	if p.accept("(") {
+		if ast.parameters, err = p.options(")", true); err != nil {
+			return nil, err
+		}
+	}
+	if p.accept("{") {
+		if ast.columns, err = p.options("}", false); err != nil {
+			return nil, err
+		}
+	}
+	if t := p.peek(); t.kind == headerWord && t.text == "nested" {
+		p.next()
+		ast.nested = true
+	}
+
+	if p.peek().kind != headerEnd {
+		switch {
+		case ast.columns == nil && ast.parameters == nil && ast.input == nil:
+			return nil, p.expected("`<-`, `(`, `{`, `nested` or end of header")
+		case ast.columns == nil && ast.parameters == nil:
+			return nil, p.expected("`(`, `{`, `nested` or end of header")
+		case ast.columns == nil:
+			return nil, p.expected("`{`, `nested` or end of header")
+		default:
+			return nil, p.expected("`nested` or end of header")
+		}
+	}
+	return ast, nil
+}
+
+func (p *headerParser) options(closing string, parameters bool) ([]headerOption, error) {
+	options := []headerOption{}
+	for {
+		var opt headerOption
+		t := p.peek()
+		switch {
+		case parameters && p.accept("$"):
+			index := p.peek()
+			if index.kind != headerWord || !isNumber(index.text) {
+				return nil, p.expected("a parameter number after `$`")
+			}
+			opt.key, opt.keyIsIndex = p.next(), true
+		case t.kind == headerQuoted:
+			opt.key = p.next()
+		case t.kind == headerWord && ((!parameters && isNumber(t.text)) || token.IsIdentifier(t.text)):
+			opt.key = p.next()
+			opt.keyIsIndex = !parameters && isNumber(t.text)
+		case parameters:
+			return nil, p.expected("`$` followed by a number or a parameter name")
+		default:
+			return nil, p.expected("a column number or name")
+		}
+
+		if !p.accept(":") {
+			return nil, p.expected("`:` after " + opt.key.String())
+		}
+
+		if t := p.peek(); t.kind == headerWord && (t.text == "null" || t.text == "notnull") {
+			opt.nullability = p.next().text
+		}
+		if t := p.peek(); t.kind == headerWord || (t.kind == headerPunctuation && (t.text == "[" || t.text == "*")) {
+			goType, err := p.goType()
+			if err != nil {
+				return nil, err
+			}
+			opt.goType = goType
+		}
+		if opt.nullability == "" && opt.goType == nil {
+			return nil, p.expected("`null`, `notnull` or a Go type")
+		}
+		options = append(options, opt)
+
+		if p.accept(closing) {
+			return options, nil
+		}
+		if !p.accept(",") {
+			return nil, p.expected("`,` or `" + closing + "`")
+		}
+	}
+}
+
+func (p *headerParser) goType() (*headerGoType, error) {
+	start := p.peek().offset
+	var b strings.Builder
+	for {
+		switch {
+		case p.accept("*"):
+			b.WriteByte('*')
+			continue
+		case p.accept("["):
+			b.WriteByte('[')
+			if t := p.peek(); t.kind == headerWord && isNumber(t.text) {
+				b.WriteString(p.next().text)
+			}
+			if !p.accept("]") {
+				return nil, p.expected("`]`")
+			}
+			b.WriteByte(']')
+			continue
+		}
+		break
+	}
+	t := p.peek()
+	if t.kind != headerWord {
+		return nil, p.expected("a Go type")
+	}
+	p.next()
+	b.WriteString(t.text)
+	if !goTypeMatcher.MatchString(b.String()) {
+		return nil, &headerError{offset: start, msg: fmt.Sprintf("invalid Go type `%s`", b.String())}
+	}
+	return &headerGoType{text: b.String(), offset: start}, nil
+}
+
+func isNumber(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if !isDigit(s[i]) {
+			return false
+		}
+	}
+	return s != ""
+}
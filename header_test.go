@@ -0,0 +1,68 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseHeaderAST(t *testing.T) {
+	ast, err := parseHeaderAST(`GetPerson->Person?  <- example.com/p.In ($1: null []*math/big.Rat, name:notnull) {"Full ""Name""": null, 2: [16]byte} nested`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ast.funcName == nil || ast.funcName.text != "GetPerson" ||
+		ast.name.text != "Person" || ast.suffix != "?" || ast.prefix != "" ||
+		ast.input == nil || ast.input.text != "example.com/p.In" || !ast.nested {
+		t.Fatalf("got %+v", ast)
+	}
+	if len(ast.parameters) != 2 ||
+		!ast.parameters[0].keyIsIndex || ast.parameters[0].key.text != "1" ||
+		ast.parameters[0].nullability != "null" || ast.parameters[0].goType.text != "[]*math/big.Rat" ||
+		ast.parameters[1].keyIsIndex || ast.parameters[1].key.text != "name" ||
+		ast.parameters[1].nullability != "notnull" || ast.parameters[1].goType != nil {
+		t.Fatalf("parameters: got %+v", ast.parameters)
+	}
+	if len(ast.columns) != 2 ||
+		ast.columns[0].key.kind != headerQuoted || ast.columns[0].key.text != `Full "Name"` ||
+		!ast.columns[1].keyIsIndex || ast.columns[1].goType.text != "[16]byte" {
+		t.Fatalf("columns: got %+v", ast.columns)
+	}
+}
+
+func TestParseHeaderErrors(t *testing.T) {
+	tests := []struct {
+		header string
+		offset int
+		msg    string
+	}{
+		{"", 0, "expected a name, got end of header"},
+		{"GetPerson -> ", 13, "expected a struct name, got end of header"},
+		{"Person {id notnull}", 11, "expected `:` after `id`, got `notnull`"},
+		{"Person {id: notnull,}", 20, "expected a column number or name, got `}`"},
+		{"Person {id: notnull", 19, "expected `,` or `}`, got end of header"},
+		{"Person ($x: int)", 9, "expected a parameter number after `$`, got `x`"},
+		{"Person (1: int)", 8, "expected `$` followed by a number or a parameter name, got `1`"},
+		{`Person {"id: int}`, 8, "unterminated quoted identifier"},
+		{"Person {id: }", 12, "expected `null`, `notnull` or a Go type, got `}`"},
+		{"Person {id: [x]int}", 13, "expected `]`, got `x`"},
+		{"Person % x", 7, "unexpected character '%'"},
+		{"Person {id: int} extra", 17, "expected `nested` or end of header, got `extra`"},
+	}
+	for _, tt := range tests {
+		_, err := parseHeaderAST(tt.header)
+		var headerErr *headerError
+		if !errors.As(err, &headerErr) {
+			t.Fatalf("%q: expected headerError, got %v", tt.header, err)
+		}
+		if headerErr.offset != tt.offset || headerErr.Error() != tt.msg {
+			t.Fatalf("%q: got %d %q, expected %d %q", tt.header, headerErr.offset, headerErr.Error(), tt.offset, tt.msg)
+		}
+	}
+
+	d := declaration{header: []byte("!Insert?"), headerOffset: 4}
+	err := d.parseHeader()
+	var headerErr *headerError
+	if !errors.As(err, &headerErr) || !errors.Is(err, errResultNoneWithOption) || d.headerPosition(headerErr.offset) != 11 {
+		t.Fatalf("got %v", err)
+	}
+}
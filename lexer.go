@@ -0,0 +1,266 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+)
+
+type sqlTokenKind int
+
+const (
+	sqlIdentifier sqlTokenKind = iota
+	sqlQuotedIdentifier
+	sqlString
+	sqlNumber
+	sqlParameter      // $1
+	sqlNamedParameter // @name
+	sqlOperator
+	sqlPunctuation // ( ) [ ] , ; . ::
+	sqlComment
+)
+
+type sqlToken struct {
+	kind       sqlTokenKind
+	start, end int // byte offsets
+}
+
+func (t sqlToken) text(b []byte) []byte {
+	return b[t.start:t.end]
+}
+
+var (
+	errUnterminatedString     = errors.New("unterminated string")
+	errUnterminatedIdentifier = errors.New("unterminated quoted identifier")
+	errUnterminatedComment    = errors.New("unterminated block comment")
+)
+
+// lexError is the position of an unterminated token.
+type lexError struct {
+	offset int
+	err    error
+}
+
+func (e *lexError) Error() string {
+	return e.err.Error()
+}
+
+func (e *lexError) Unwrap() error {
+	return e.err
+}
+
+const sqlOperatorCharacters = "+-*/<>=~!@#%^&|`?"
+
+// lexSQL splits SQL into tokens, whitespace is skipped.
+// Block comments can be nested, strings can be dollar quoted ($$...$$),
+// use backslash escapes (E'...') or Unicode escapes (U&'...').
+func lexSQL(b []byte) ([]sqlToken, error) {
+	var tokens []sqlToken
+	i := 0
+	for i < len(b) {
+		ch := b[i]
+		start := i
+		var kind sqlTokenKind
+		switch {
+		case ch == ' ' || ch == '\t' || ch == '\r' || ch == '\n' || ch == '\f':
+			i++
+			continue
+		case ch == '-' && i+1 < len(b) && b[i+1] == '-':
+			end := bytes.IndexByte(b[i:], '\n')
+			if end < 0 {
+				i = len(b)
+			} else {
+				i += end
+			}
+			kind = sqlComment
+		case ch == '/' && i+1 < len(b) && b[i+1] == '*':
+			end, ok := blockCommentEnd(b[i:])
+			if !ok {
+				return nil, &lexError{offset: start, err: errUnterminatedComment}
+			}
+			i += end
+			kind = sqlComment
+		case (ch == 'E' || ch == 'e') && i+1 < len(b) && b[i+1] == '\'':
+			end, ok := escapedStringEnd(b[i+1:])
+			if !ok {
+				return nil, &lexError{offset: start, err: errUnterminatedString}
+			}
+			i += 1 + end
+			kind = sqlString
+		case (ch == 'U' || ch == 'u') && i+2 < len(b) && b[i+1] == '&' && (b[i+2] == '\'' || b[i+2] == '"'):
+			end, ok := quotedEndBytes(b[i+2:], b[i+2])
+			if !ok {
+				if b[i+2] == '"' {
+					return nil, &lexError{offset: start, err: errUnterminatedIdentifier}
+				}
+				return nil, &lexError{offset: start, err: errUnterminatedString}
+			}
+			i += 2 + end
+			kind = sqlString
+			if b[start+2] == '"' {
+				kind = sqlQuotedIdentifier
+			}
+		case ch == '\'':
+			end, ok := quotedEndBytes(b[i:], '\'')
+			if !ok {
+				return nil, &lexError{offset: start, err: errUnterminatedString}
+			}
+			i += end
+			kind = sqlString
+		case ch == '"':
+			end, ok := quotedEndBytes(b[i:], '"')
+			if !ok {
+				return nil, &lexError{offset: start, err: errUnterminatedIdentifier}
+			}
+			i += end
+			kind = sqlQuotedIdentifier
+		case ch == '$' && i+1 < len(b) && isDigit(b[i+1]):
+			i++
+			for i < len(b) && isDigit(b[i]) {
+				i++
+			}
+			kind = sqlParameter
+		case ch == '$' && dollarTagLength(b[i:]) > 0:
+			end, ok := dollarQuotedEnd(b[i:])
+			if !ok {
+				return nil, &lexError{offset: start, err: errUnterminatedString}
+			}
+			i += end
+			kind = sqlString
+		case ch == '@' && i+1 < len(b) && isIdentifierStart(b[i+1]) &&
+			(i == 0 || !isOperatorCharacter(b[i-1])):
+			// not an operator like <@
+			i++
+			for i < len(b) && isIdentifierPart(b[i]) {
+				i++
+			}
+			kind = sqlNamedParameter
+		case isDigit(ch):
+			for i < len(b) && (isDigit(b[i]) || b[i] == '.' || b[i] == 'e' || b[i] == 'E') {
+				i++
+			}
+			kind = sqlNumber
+		case isIdentifierStart(ch):
+			for i < len(b) && isIdentifierPart(b[i]) {
+				i++
+			}
+			kind = sqlIdentifier
+		case ch == ':' && i+1 < len(b) && b[i+1] == ':':
+			i += 2
+			kind = sqlPunctuation
+		case bytes.IndexByte([]byte("()[],;.:"), ch) >= 0:
+			i++
+			kind = sqlPunctuation
+		case isOperatorCharacter(ch):
+			for i < len(b) && isOperatorCharacter(b[i]) {
+				if i > start && (bytes.HasPrefix(b[i:], []byte("--")) || bytes.HasPrefix(b[i:], []byte("/*"))) {
+					// comments end operators
+					break
+				}
+				i++
+			}
+			kind = sqlOperator
+		default:
+			i++
+			kind = sqlOperator
+		}
+		tokens = append(tokens, sqlToken{kind: kind, start: start, end: i})
+	}
+	return tokens, nil
+}
+
+// quotedEndBytes returns the index after the closing quote,
+// quotes are escaped by doubling them.
+func quotedEndBytes(b []byte, quote byte) (int, bool) {
+	for i := 1; i < len(b); i++ {
+		if b[i] != quote {
+			continue
+		}
+		if i+1 < len(b) && b[i+1] == quote {
+			i++
+			continue
+		}
+		return i + 1, true
+	}
+	return 0, false
+}
+
+// escapedStringEnd is like quotedEndBytes,
+// but also allows escaping with a backslash.
+func escapedStringEnd(b []byte) (int, bool) {
+	for i := 1; i < len(b); i++ {
+		switch b[i] {
+		case '\\':
+			i++
+		case '\'':
+			if i+1 < len(b) && b[i+1] == '\'' {
+				i++
+				continue
+			}
+			return i + 1, true
+		}
+	}
+	return 0, false
+}
+
+// blockCommentEnd returns the index after the comment,
+// block comments can be nested.
+func blockCommentEnd(b []byte) (int, bool) {
+	depth := 0
+	for i := 0; i+1 < len(b); i++ {
+		switch {
+		case b[i] == '/' && b[i+1] == '*':
+			depth++
+			i++
+		case b[i] == '*' && b[i+1] == '/':
+			depth--
+			i++
+			if depth == 0 {
+				return i + 1, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// dollarTagLength returns the length of $$ or $tag$ at the start of b,
+// or 0 if there is none. Tags can not start with a digit.
+func dollarTagLength(b []byte) int {
+	if len(b) < 2 || isDigit(b[1]) {
+		return 0
+	}
+	for i := 1; i < len(b); i++ {
+		if b[i] == '$' {
+			return i + 1
+		}
+		if !isIdentifierPart(b[i]) {
+			return 0
+		}
+	}
+	return 0
+}
+
+// dollarQuotedEnd handles $$...$$ and $tag$...$tag$.
+func dollarQuotedEnd(b []byte) (int, bool) {
+	tag := b[:dollarTagLength(b)]
+	end := bytes.Index(b[len(tag):], tag)
+	if end < 0 {
+		return 0, false
+	}
+	return len(tag) + end + len(tag), true
+}
+
+func isOperatorCharacter(ch byte) bool {
+	return bytes.IndexByte([]byte(sqlOperatorCharacters), ch) >= 0
+}
+
+func isDigit(ch byte) bool {
+	return ch >= '0' && ch <= '9'
+}
+
+func isIdentifierStart(ch byte) bool {
+	return ch == '_' || (ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z') || ch >= 0x80
+}
+
+func isIdentifierPart(ch byte) bool {
+	return isIdentifierStart(ch) || isDigit(ch) || ch == '$'
+}
@@ -1,14 +1,14 @@
 package main
 
 import (
-	"bytes"
-	"encoding/json"
 	"errors"
 	"fmt"
+	"go/types"
+	"io"
 	"os"
-	"strconv"
+	"path"
+	"path/filepath"
 	"strings"
-	"unicode"
 
 	"github.com/erikfastermann/sql/postgres"
 	"github.com/erikfastermann/sql/util"
@@ -16,74 +16,53 @@ import (
 
 // TODO:
 //   - dependency tracking
-//   - check valid go identifier
 //   - no duplicate columnOption's
 
 func main() {
-	if err := run(); err != nil {
-		fmt.Fprintf(os.Stderr, "error: %v\n", err)
-		os.Exit(1)
-	}
+	os.Exit(runCommand(os.Args[1:], os.Stdout, os.Stderr))
 }
 
-func run() error {
-	if len(os.Args) != 2 {
-		return fmt.Errorf("USAGE: %s config-file", os.Args[0])
-	}
-	configPath := os.Args[1]
-	config, err := loadConfig(configPath)
-	if err != nil {
-		return err
-	}
-	builder, err := newBuilder(config)
-	if err != nil {
-		return err
-	}
-	return builder.run()
-}
+type builder struct {
+	config     *config
+	conn       *postgres.Conn // TODO: pool
+	attributes map[pgAttributeKey]pgAttributeValue
+	types      map[int]pgType
+	enums      map[int][]string
+	nullable   nullableStrategy
+	parser     parser
 
-// TODO: check fields set
-type config struct {
-	Address  string
-	Username string
-	Password string
-	Database string
+	nullabilityInference bool
+	relations            map[pgRelationKey]int
+	relationNames        map[int]string
+	attributesByName     map[pgAttributeNameKey]pgAttributeValue
 
-	SQLFiles []string
+	resolvedTypes map[int]*resolvedType
 
-	// TODO: maybe as database table
-	PostgresOidToGoType map[int]TypeInfo
-}
+	tables         []*tableType
+	tablesByGoName map[string]*tableType
 
-type TypeInfo struct {
-	Postgres string
-	Go       string // package path as prefix if any
+	goPackages map[string]*types.Package // loaded on first use
+
+	file fileDirectives // of the SQL file being processed
+
+	outputDir string // relative output paths are resolved against it
+	verbose   bool
+	log       io.Writer
 }
 
-func loadConfig(path string) (*config, error) {
-	f, err := os.Open(path)
+func newBuilder(config *config) (*builder, error) {
+	nullable, err := parseNullableStrategy(config.Nullable)
 	if err != nil {
 		return nil, err
 	}
-	defer f.Close()
-
-	dec := json.NewDecoder(f)
-	dec.DisallowUnknownFields()
-	var c config
-	if err := dec.Decode(&c); err != nil {
+	if nullable == nullableDefault {
+		nullable = nullablePointer
+	}
+	enc, err := parseEncoding(config.Encoding)
+	if err != nil {
 		return nil, err
 	}
-	return &c, nil
-}
 
-type builder struct {
-	config     *config
-	conn       *postgres.Conn // TODO: pool
-	attributes map[pgAttributeKey]pgAttributeValue
-	parser     parser
-}
-
-func newBuilder(config *config) (*builder, error) {
 	conn, err := postgres.Connect(config.Address, config.Username, config.Password, config.Database)
 	if err != nil {
 		return nil, err
@@ -94,11 +73,52 @@ func newBuilder(config *config) (*builder, error) {
 		return nil, err
 	}
 
+	types, err := getPostgresTypes(conn)
+	if err != nil {
+		return nil, err
+	}
+
+	enums, err := getPostgresEnums(conn)
+	if err != nil {
+		return nil, err
+	}
+
+	relations, err := getPostgresRelations(conn)
+	if err != nil {
+		return nil, err
+	}
+	relationNames := make(map[int]string, len(relations))
+	for key, oid := range relations {
+		relationNames[oid] = key.name
+	}
+	attributesByName := make(map[pgAttributeNameKey]pgAttributeValue, len(attributes))
+	for key, attr := range attributes {
+		if !attr.dropped {
+			attributesByName[pgAttributeNameKey{relid: key.relid, name: attr.name}] = attr
+		}
+	}
+
 	b := &builder{
 		config:     config,
 		conn:       conn,
 		attributes: attributes,
+		types:      types,
+		enums:      enums,
+		nullable:   nullable,
+
+		relations:        relations,
+		relationNames:    relationNames,
+		attributesByName: attributesByName,
+
+		resolvedTypes: make(map[int]*resolvedType),
+
+		tablesByGoName: make(map[string]*tableType),
+	}
+	b.parser.encoding = enc
+	if err := b.loadTables(); err != nil {
+		return nil, err
 	}
+	b.nullabilityInference = b.enableNullabilityInference()
 
 	return b, nil
 }
@@ -110,10 +130,12 @@ type pgAttributeKey struct {
 type pgAttributeValue struct {
 	name    string
 	notNull bool
+	typeOid int
+	dropped bool
 }
 
 func getPostgresAttributes(c *postgres.Conn) (map[pgAttributeKey]pgAttributeValue, error) {
-	const query = "select attrelid, attnum, attname, attnotnull from pg_attribute"
+	const query = "select attrelid, attnum, attname, attnotnull, atttypid, attisdropped from pg_attribute"
 	if err := c.RunQuery(query); err != nil {
 		return nil, err
 	}
@@ -121,8 +143,10 @@ func getPostgresAttributes(c *postgres.Conn) (map[pgAttributeKey]pgAttributeValu
 	for c.NextRow() {
 		attrelid := util.Check2(c.FieldInt(0))
 		attnum := util.Check2(c.FieldInt(1))
-		attname := string(c.FieldBorrowRawBytes(2))
+		attname := util.Check2(c.FieldString(2))
 		attnotnull := util.Check2(c.FieldBool(3))
+		atttypid := util.Check2(c.FieldInt(4))
+		attisdropped := util.Check2(c.FieldBool(5))
 
 		key := pgAttributeKey{
 			relid: attrelid,
@@ -134,6 +158,8 @@ func getPostgresAttributes(c *postgres.Conn) (map[pgAttributeKey]pgAttributeValu
 		attributes[key] = pgAttributeValue{
 			name:    attname,
 			notNull: attnotnull,
+			typeOid: atttypid,
+			dropped: attisdropped,
 		}
 	}
 	if err := c.CloseQuery(); err != nil {
@@ -146,31 +172,153 @@ func (b *builder) Close() error {
 	return b.conn.Close()
 }
 
-func (b *builder) run() error {
-	if len(b.config.SQLFiles) == 0 {
-		return errors.New("no sql files to process")
+func (b *builder) logf(format string, args ...interface{}) {
+	if b.verbose && b.log != nil {
+		fmt.Fprintf(b.log, format+"\n", args...)
+	}
+}
+
+// generatedFile is the formatted source of an output file.
+type generatedFile struct {
+	path   string
+	source []byte
+}
+
+// generateFiles processes the SQL files and returns the generated files
+// without writing them. If only (glob patterns) is set, just the packages
+// with at least one matching SQL file are generated.
+func (b *builder) generateFiles(only []string) ([]generatedFile, error) {
+	sqlFiles, err := findSQLFiles(b.config.SQLFiles, b.config.ExcludeSQLFiles)
+	if err != nil {
+		return nil, err
 	}
-	for _, sqlFile := range b.config.SQLFiles {
-		if err := b.processFile(sqlFile); err != nil {
-			return fmt.Errorf("%s: %w", sqlFile, err)
+	if len(only) > 0 {
+		if sqlFiles, err = b.selectSQLFiles(sqlFiles, only); err != nil {
+			return nil, err
 		}
 	}
-	return nil
+
+	// the queries are grouped by the output file,
+	// the output files by the package (their directory)
+	var outputs []string
+	packages := make(map[string]string)
+	queries := make(map[string][]query)
+	for _, sqlFile := range sqlFiles {
+		b.logf("processing %s", sqlFile)
+		fileQueries, err := b.processFile(sqlFile)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", sqlFile, err)
+		}
+		output, dir, pkg := b.file.output, filepath.Dir(b.file.output), b.file.pkg
+		if existing, ok := packages[dir]; ok && existing != pkg {
+			return nil, fmt.Errorf("%s: package %s, but other files in %s use package %s", sqlFile, pkg, dir, existing)
+		} else if !ok {
+			packages[dir] = pkg
+		}
+		if _, ok := queries[output]; !ok {
+			outputs = append(outputs, output)
+		}
+		queries[output] = append(queries[output], fileQueries...)
+	}
+
+	if err := checkPackageNames(outputs, queries); err != nil {
+		return nil, err
+	}
+	files := make([]generatedFile, 0, len(outputs))
+	decls := make(map[string]*packageDecls)
+	for _, output := range outputs {
+		// shared types are written into the first file of the package
+		dir, tables := filepath.Dir(output), []*tableType(nil)
+		if decls[dir] == nil {
+			decls[dir], tables = newPackageDecls(), b.tables
+		}
+		source, err := decls[dir].generate(packages[dir], tables, queries[output])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", output, err)
+		}
+		b.logf("generated %s (%d queries)", output, len(queries[output]))
+		files = append(files, generatedFile{path: output, source: source})
+	}
+	return files, nil
 }
 
-func (b *builder) processFile(path string) error {
+var errNoSelectedFiles = errors.New("no sql file matches -only")
+
+// selectSQLFiles returns the SQL files which share a package (the directory
+// of the output file) with a file matching one of the patterns, only the
+// directives of the files are read. The whole package is generated, because
+// the shared types are declared in the first file of the package.
+func (b *builder) selectSQLFiles(sqlFiles, patterns []string) ([]string, error) {
+	dirs := make([]string, len(sqlFiles))
+	selected := make(map[string]bool)
+	for i, sqlFile := range sqlFiles {
+		if err := b.parser.init(sqlFile); err != nil {
+			return nil, fmt.Errorf("%s: %w", sqlFile, err)
+		}
+		if err := b.parser.parseDirectives(); err != nil {
+			return nil, fmt.Errorf("%s: %w", sqlFile, err)
+		}
+		file, err := b.fileDirectives(sqlFile)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", sqlFile, err)
+		}
+		dirs[i] = filepath.Dir(file.output)
+		for _, pattern := range patterns {
+			matched, err := matchGlob(path.Clean(filepath.ToSlash(pattern)), filepath.ToSlash(sqlFile))
+			if err != nil {
+				return nil, fmt.Errorf("-only %q: %w", pattern, err)
+			}
+			if matched {
+				selected[dirs[i]] = true
+			}
+		}
+	}
+	var files []string
+	for i, sqlFile := range sqlFiles {
+		if selected[dirs[i]] {
+			files = append(files, sqlFile)
+		}
+	}
+	if len(files) == 0 {
+		return nil, errNoSelectedFiles
+	}
+	return files, nil
+}
+
+var (
+	errNoOutput  = errors.New("no output file, set Output in the config or use --! output")
+	errNoPackage = errors.New("no package name, set Package in the config or use --! package")
+)
+
+func (b *builder) processFile(path string) ([]query, error) {
 	if err := b.parser.init(path); err != nil {
-		return err
+		return nil, err
+	}
+	if err := b.parser.parseDirectives(); err != nil {
+		return nil, err
 	}
+	file, err := b.fileDirectives(path)
+	if err != nil {
+		return nil, err
+	}
+	if file.output == "" {
+		return nil, errNoOutput
+	}
+	if file.pkg == "" {
+		return nil, errNoPackage
+	}
+	b.file = file
 	if err := b.parser.buildRawDeclarations(); err != nil {
-		return err
+		return nil, err
 	}
 
+	queries := make([]query, 0, len(b.parser.declarations))
 	for i := range b.parser.declarations {
 		decl := &b.parser.declarations[i]
-		if err := b.processDeclaration(decl); err != nil {
+		q, err := b.processDeclaration(decl)
+		if err != nil {
 			if errorDetail, ok := b.formatError(decl, err); ok {
-				return fmt.Errorf(
+				return nil, fmt.Errorf(
 					"line %d-%d: %w\n%s",
 					decl.startLineIndex+1,
 					decl.endLineIndex+1,
@@ -178,22 +326,54 @@ func (b *builder) processFile(path string) error {
 					errorDetail,
 				)
 			}
-			return fmt.Errorf(
+			return nil, fmt.Errorf(
 				"line %d-%d: %w",
 				decl.startLineIndex+1,
 				decl.endLineIndex+1,
 				err,
 			)
 		}
+		q.source = fmt.Sprintf("%s:%d-%d", path, decl.startLineIndex+1, decl.endLineIndex+1)
+		queries = append(queries, q)
 	}
 
-	return nil
+	return queries, nil
+}
+
+// query is the result of processing a declaration,
+// it does not reference the buffer of the parser.
+type query struct {
+	resultKind  resultKind
+	resultCount resultCount
+	funcName    string
+	structName  string
+	inputStruct string // optional, name or Go type
+	body        string
+	source      string // path and line range, for errors
+
+	doc  []string // documentation of the declaration
+	text string   // SQL as written in the file, for the documentation
+
+	parameters []parameter
+	fields     []field
+}
+
+type parameter struct {
+	name    string // might be empty
+	typ     *resolvedType
+	notNull bool
+	goName  string // field of an existing input struct
 }
 
 type field struct {
 	name    string
-	typ     TypeInfo
+	typ     *resolvedType
 	notNull bool
+
+	table  string // empty if the column is not from a table
+	alias  string // table alias, might be empty
+	group  string // nested struct, empty for top level fields
+	goName string // field of an existing Go struct
 }
 
 var (
@@ -206,47 +386,144 @@ var (
 	errColumnOptionDuplicate = errors.New(
 		"multiple column options reference the same field",
 	)
+	errParameterOptionDuplicate = errors.New(
+		"multiple parameter options reference the same parameter",
+	)
 	errResultDirectManyWithMoreThanOneColumn = errors.New(
 		"result kind direct (`#`) with count many (`+`) returns not exactly one column",
 	)
-	errBlankFieldName = errors.New("blank field name")
+	errBlankFieldName              = errors.New("blank field name")
+	errInputStructUnnamedParameter = errors.New(
+		"input struct (`<-`) requires named parameters (@name or inferred)",
+	)
 )
 
-func (b *builder) processDeclaration(decl *declaration) error {
+func (b *builder) processDeclaration(decl *declaration) (query, error) {
 	if err := decl.parse(&b.parser); err != nil {
-		return err
+		return query{}, err
+	}
+	decl.resolveImports(b.file.imports)
+
+	text := string(decl.body)
+	body, names, offsets, err := rewriteNamedParameters(decl.body)
+	if err != nil {
+		return query{}, err
 	}
+	decl.body, decl.bodyOffsets = body, offsets
 
 	withRowDescription, err := b.conn.GetQueryMetadata(decl.body)
 	if err != nil {
-		return err
+		return query{}, err
 	}
 
 	if decl.resultKind == resultNone && withRowDescription {
-		return errResultNoneHasRowDescription
+		return query{}, errResultNoneHasRowDescription
 	}
 
-	parameters := make([]TypeInfo, len(b.conn.CurrentParameterOids))
+	if names == nil {
+		names = inferParameterNames(decl.body, len(b.conn.CurrentParameterOids))
+	}
+	parameters := make([]parameter, len(b.conn.CurrentParameterOids))
 	for i, oid := range b.conn.CurrentParameterOids {
-		typ, ok := b.config.PostgresOidToGoType[oid]
-		if !ok {
-			return fmt.Errorf("unknown type oid %d", oid)
+		typ, err := b.resolveType(oid)
+		if err != nil {
+			return query{}, fmt.Errorf("parameter $%d: %w", i+1, err)
+		}
+		parameters[i] = parameter{typ: typ, notNull: true}
+		if i < len(names) {
+			parameters[i].name = names[i]
+		}
+	}
+
+	seenParameters := make([]bool, len(parameters))
+	for _, opt := range decl.parameterOptions {
+		var index int
+		if opt.index > 0 {
+			index = opt.index - 1
+			if index >= len(parameters) {
+				return query{}, fmt.Errorf(
+					"parameter option index out of range ($%d, len: %d)",
+					opt.index,
+					len(parameters),
+				)
+			}
+		} else {
+			index = -1
+			for i, p := range parameters {
+				if p.name != "" && p.name == string(opt.name) {
+					index = i
+					break
+				}
+			}
+			if index < 0 {
+				return query{}, fmt.Errorf("unknown parameter option name %q", opt.name)
+			}
+		}
+		if seenParameters[index] {
+			return query{}, errParameterOptionDuplicate
+		}
+		if opt.hasNullability {
+			parameters[index].notNull = opt.notNull
+		}
+		if len(opt.goType) != 0 {
+			parameters[index].typ = withGoType(parameters[index].typ, string(opt.goType))
+		}
+		seenParameters[index] = true
+	}
+
+	if len(decl.inputStruct) != 0 {
+		names := make([]string, len(parameters))
+		for i, p := range parameters {
+			if p.name == "" {
+				return query{}, fmt.Errorf(
+					"parameter $%d: %w",
+					i+1,
+					errInputStructUnnamedParameter,
+				)
+			}
+			names[i] = p.name
+		}
+		if err := checkFieldNames(names); err != nil {
+			return query{}, err
+		}
+		if isGoTypeReference(string(decl.inputStruct)) {
+			if err := b.matchGoInputStruct(string(decl.inputStruct), parameters); err != nil {
+				return query{}, err
+			}
 		}
-		parameters[i] = typ
 	}
 
 	fields, err := b.processFields(decl)
 	if err != nil {
-		return err
+		return query{}, err
+	}
+	if decl.resultKind == resultStruct {
+		if isGoTypeReference(string(decl.structName)) {
+			err = b.matchGoStruct(string(decl.structName), fields)
+		} else {
+			err = b.checkTableStruct(string(decl.structName), fields)
+		}
+		if err != nil {
+			return query{}, err
+		}
 	}
 
-	fmt.Printf("%+v\n", parameters)
-	fmt.Printf("%+v\n", fields)
-
-	return nil
+	return query{
+		resultKind:  decl.resultKind,
+		resultCount: decl.resultCount,
+		funcName:    string(decl.funcName),
+		structName:  string(decl.structName),
+		inputStruct: string(decl.inputStruct),
+		body:        string(decl.body),
+		doc:         decl.doc,
+		text:        text,
+		parameters:  parameters,
+		fields:      fields,
+	}, nil
 }
 
 func (b *builder) processFields(decl *declaration) ([]field, error) {
+	parameterCount := len(b.conn.CurrentParameterOids)
 	fields := make([]field, len(b.conn.CurrentFields))
 	for i := range b.conn.CurrentFields {
 		f := &b.conn.CurrentFields[i]
@@ -272,6 +549,11 @@ func (b *builder) processFields(decl *declaration) ([]field, error) {
 		fieldNames[f.name] = i
 	}
 
+	// overwrites the current fields of the connection
+	if err := b.inferNullability(decl.body, parameterCount, fields); err != nil {
+		return nil, err
+	}
+
 	seenFields := make([]bool, len(fields))
 	for _, opt := range decl.columnOptions {
 		var index int
@@ -294,15 +576,79 @@ func (b *builder) processFields(decl *declaration) ([]field, error) {
 		if seenFields[index] {
 			return nil, errColumnOptionDuplicate
 		}
-		fields[index].notNull = opt.notNull
+		if opt.hasNullability {
+			fields[index].notNull = opt.notNull
+		}
+		if len(opt.goType) != 0 {
+			fields[index].typ = withGoType(fields[index].typ, string(opt.goType))
+		}
 		seenFields[index] = true
 	}
 
-	// TODO: check field names are valid go identifiers with resultKind == resultStruct
+	if decl.nested {
+		groupFields(fields)
+	}
+	if decl.resultKind == resultStruct && !isGoTypeReference(string(decl.structName)) {
+		if err := checkStructFields(fields); err != nil {
+			return nil, err
+		}
+	}
 
 	return fields, nil
 }
 
+// checkStructFields checks the Go names of the fields,
+// nested structs are checked separately.
+func checkStructFields(fields []field) error {
+	var topLevel []string
+	groups := make(map[string][]string)
+	for _, f := range fields {
+		if f.group == "" {
+			topLevel = append(topLevel, f.name)
+			continue
+		}
+		if _, ok := groups[f.group]; !ok {
+			topLevel = append(topLevel, f.group)
+		}
+		groups[f.group] = append(groups[f.group], f.name)
+	}
+	if err := checkFieldNames(topLevel); err != nil {
+		return err
+	}
+	for _, names := range groups {
+		if err := checkFieldNames(names); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// groupFields assigns the columns of tables to a nested struct per table.
+// The struct is named after the table, or after the alias
+// if the table is used multiple times (e.g. in self joins).
+func groupFields(fields []field) {
+	aliases := make(map[string]map[string]bool)
+	for _, f := range fields {
+		if f.table == "" {
+			continue
+		}
+		if aliases[f.table] == nil {
+			aliases[f.table] = make(map[string]bool)
+		}
+		aliases[f.table][f.alias] = true
+	}
+	for i := range fields {
+		f := &fields[i]
+		switch {
+		case f.table == "":
+		case len(aliases[f.table]) == 1 || f.alias == "":
+			f.group = f.table
+		default:
+			f.group = f.alias
+		}
+	}
+}
+
 func (b *builder) processField(f *postgres.Field) (field, error) {
 	// assume not null (checked in generated code)
 	newField := field{notNull: true}
@@ -316,6 +662,7 @@ func (b *builder) processField(f *postgres.Field) (field, error) {
 			panic("internal error")
 		}
 
+		newField.table = b.relationNames[f.MaybeTableOid]
 		if attr.name != string(f.Name) {
 			newField.name = string(f.Name)
 		} else {
@@ -329,57 +676,47 @@ func (b *builder) processField(f *postgres.Field) (field, error) {
 		return field{}, errBlankFieldName
 	}
 
-	typ, ok := b.config.PostgresOidToGoType[f.TypeOid]
-	if !ok {
-		return field{}, fmt.Errorf(
-			"unknown type oid %d of field %s",
-			f.TypeOid,
-			newField.name,
-		)
+	typ, err := b.resolveType(f.TypeOid)
+	if err != nil {
+		return field{}, fmt.Errorf("field %s: %w", newField.name, err)
 	}
 	newField.typ = typ
+	if typ.notNull {
+		newField.notNull = true
+	}
 
 	return newField, nil
 }
 
 func (b *builder) formatError(decl *declaration, err error) (string, bool) {
-	// assumes UTF-8, does not work with characters larger than a single rune
+	var headerErr *headerError
+	if errors.As(err, &headerErr) {
+		line := b.parser.lineAt(decl.startLineIndex)
+		offset, _ := characterOffset(line, decl.headerPosition(headerErr.offset)+1)
+		return formatErrorLine(line, decl.startLineIndex, offset), true
+	}
+
+	var bodyErr *bodyError
+	if errors.As(err, &bodyErr) {
+		return formatErrorAt(b.parser.b.Bytes(), bodyErr.offset), true
+	}
 
 	var postgresError *postgres.Error
 	if !errors.As(err, &postgresError) {
 		return "", false
 	}
-	if postgresError.Position == 0 {
-		return "", false
+	var details []string
+	// positions count characters, starting at 1
+	if offset, ok := characterOffset(decl.body, postgresError.Position); ok {
+		offset = decl.bodyOffsets.original(offset)
+		details = append(details, formatErrorAt(b.parser.b.Bytes(), decl.bodyOffset+offset))
 	}
-	remainingCharacters := postgresError.Position
-	for i := decl.startLineIndex + 1; i <= decl.endLineIndex; i++ {
-		line := b.parser.lineAt(i)
-		remainingCharactersLine := remainingCharacters
-		for range string(line) {
-			remainingCharacters--
-			if remainingCharacters <= 0 {
-				return formatErrorLine(line, i, remainingCharactersLine-1), true
-			}
-		}
+	query := []byte(postgresError.QueryInternal)
+	if offset, ok := characterOffset(query, postgresError.PositionInternal); ok {
+		details = append(details, "internal query:\n"+formatErrorAt(query, offset))
 	}
-	return "", false
-}
-
-func formatErrorLine(line []byte, lineIndex, errorPosition int) string {
-	var b strings.Builder
-	lineNumber := strconv.Itoa(lineIndex + 1)
-	b.WriteString(lineNumber)
-	b.WriteString(" | ")
-	b.Write(bytes.TrimRightFunc(line, unicode.IsSpace))
-	b.WriteByte('\n')
-	for j := 0; j < len(lineNumber); j++ {
-		b.WriteByte(' ')
-	}
-	b.WriteString(" | ")
-	for j := 0; j < errorPosition; j++ {
-		b.WriteByte(' ')
-	}
-	b.WriteByte('^')
-	return b.String()
+	if len(details) == 0 {
+		return "", false
+	}
+	return strings.Join(details, "\n"), true
 }
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"go/token"
+	"go/types"
+	"strings"
+	"unicode"
+)
+
+// commonInitialisms are written in upper case in Go names,
+// e.g. friend_id becomes FriendID.
+var commonInitialisms = map[string]bool{
+	"ACL":   true,
+	"API":   true,
+	"ASCII": true,
+	"CPU":   true,
+	"CSS":   true,
+	"DNS":   true,
+	"EOF":   true,
+	"GUID":  true,
+	"HTML":  true,
+	"HTTP":  true,
+	"HTTPS": true,
+	"ID":    true,
+	"IP":    true,
+	"JSON":  true,
+	"LHS":   true,
+	"QPS":   true,
+	"RAM":   true,
+	"RHS":   true,
+	"RPC":   true,
+	"SLA":   true,
+	"SMTP":  true,
+	"SQL":   true,
+	"SSH":   true,
+	"TCP":   true,
+	"TLS":   true,
+	"TTL":   true,
+	"UDP":   true,
+	"UI":    true,
+	"UID":   true,
+	"URI":   true,
+	"URL":   true,
+	"UTC":   true,
+	"UTF8":  true,
+	"UUID":  true,
+	"VM":    true,
+	"XML":   true,
+	"XMPP":  true,
+	"XSRF":  true,
+	"XSS":   true,
+}
+
+// nameParts splits a snake_case name, the parts are converted
+// to initialisms or get an upper case first letter. Names containing
+// other characters than letters, digits and underscores return nil.
+func nameParts(name string) []string {
+	var parts []string
+	for _, part := range strings.Split(name, "_") {
+		if part == "" {
+			continue
+		}
+		for _, r := range part {
+			if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+				return nil
+			}
+		}
+		if upper := strings.ToUpper(part); commonInitialisms[upper] {
+			part = upper
+		} else {
+			part = upperFirst(part)
+		}
+		parts = append(parts, part)
+	}
+	return parts
+}
+
+// exportedName converts e.g. friend_id to FriendID,
+// names containing other characters than letters, digits
+// and underscores result in an empty string.
+func exportedName(name string) string {
+	return strings.Join(nameParts(name), "")
+}
+
+// unexportedName converts e.g. id to id and user_id to userID.
+func unexportedName(name string) string {
+	parts := nameParts(name)
+	if len(parts) == 0 {
+		return ""
+	}
+	if commonInitialisms[parts[0]] {
+		parts[0] = strings.ToLower(parts[0])
+	} else {
+		parts[0] = lowerFirst(parts[0])
+	}
+	return strings.Join(parts, "")
+}
+
+var errReservedName = errors.New("Go keyword or predeclared identifier")
+
+// checkDeclaredName reports names which can not be declared
+// in the generated code or would shadow predeclared identifiers.
+func checkDeclaredName(name string) error {
+	if !token.IsIdentifier(name) || name == "_" {
+		return fmt.Errorf("%q: %w", name, errInvalidIdentifier)
+	}
+	if token.IsKeyword(name) || types.Universe.Lookup(name) != nil {
+		return fmt.Errorf("%q: %w", name, errReservedName)
+	}
+	return nil
+}
+
+// checkFieldNames reports names which are not valid
+// or collide after the conversion to Go.
+func checkFieldNames(names []string) error {
+	seen := make(map[string]string, len(names))
+	for _, name := range names {
+		goName := exportedName(name)
+		if !token.IsIdentifier(goName) {
+			return fmt.Errorf("field %q: %w", name, errInvalidIdentifier)
+		}
+		if other, ok := seen[goName]; ok {
+			return fmt.Errorf("fields %q and %q are both named %s in Go", other, name, goName)
+		}
+		seen[goName] = name
+	}
+	return nil
+}
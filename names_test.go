@@ -0,0 +1,53 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNames(t *testing.T) {
+	tests := []struct {
+		name, exported, unexported string
+	}{
+		{"friend_id", "FriendID", "friendID"},
+		{"id", "ID", "id"},
+		{"url_path", "URLPath", "urlPath"},
+		{"json_data", "JSONData", "jsonData"},
+		{"created_at", "CreatedAt", "createdAt"},
+		{"_leading__double_", "LeadingDouble", "leadingDouble"},
+		{"userName", "UserName", "userName"},
+		{"größe", "Größe", "größe"},
+		{"x y", "", ""},
+	}
+	for _, tt := range tests {
+		if got := exportedName(tt.name); got != tt.exported {
+			t.Fatalf("exportedName(%q): got %q, expected %q", tt.name, got, tt.exported)
+		}
+		if got := unexportedName(tt.name); got != tt.unexported {
+			t.Fatalf("unexportedName(%q): got %q, expected %q", tt.name, got, tt.unexported)
+		}
+	}
+}
+
+func TestCheckNames(t *testing.T) {
+	for _, name := range []string{"GetPerson", "person", "_person"} {
+		if err := checkDeclaredName(name); err != nil {
+			t.Fatalf("%q: %v", name, err)
+		}
+	}
+	for _, name := range []string{"type", "string", "error", "_", "1a"} {
+		if err := checkDeclaredName(name); err == nil {
+			t.Fatalf("%q: expected error", name)
+		}
+	}
+
+	if err := checkFieldNames([]string{"friend_id", "friendId"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkFieldNames([]string{"friend_id", "friend_ID"}); err == nil {
+		t.Fatal("expected collision")
+	}
+	if err := checkFieldNames([]string{"count(*)"}); !errors.Is(err, errInvalidIdentifier) {
+		t.Fatalf("expected errInvalidIdentifier, got %v", err)
+	}
+}
@@ -0,0 +1,696 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/erikfastermann/sql/postgres"
+	"github.com/erikfastermann/sql/util"
+)
+
+// Nullability of the result columns is inferred from the generic plan
+// of the query (EXPLAIN VERBOSE). The output expressions of the plan
+// are deparsed SQL, they are analyzed with a small expression parser.
+// Outer joins mark the columns of the nullable side as nullable.
+
+type nullability int
+
+const (
+	// keep the nullability derived from the row description
+	nullabilityUnknown nullability = iota
+	nullabilityNullable
+	nullabilityNotNull
+)
+
+type pgRelationKey struct {
+	schema, name string
+}
+
+func getPostgresRelations(c *postgres.Conn) (map[pgRelationKey]int, error) {
+	const query = "select c.oid, n.nspname, c.relname " +
+		"from pg_class c join pg_namespace n on n.oid = c.relnamespace"
+	if err := c.RunQuery(query); err != nil {
+		return nil, err
+	}
+	relations := make(map[pgRelationKey]int)
+	for c.NextRow() {
+		oid := util.Check2(c.FieldInt(0))
+		nspname := util.Check2(c.FieldString(1))
+		relname := util.Check2(c.FieldString(2))
+		relations[pgRelationKey{schema: nspname, name: relname}] = oid
+	}
+	if err := c.CloseQuery(); err != nil {
+		return nil, err
+	}
+	return relations, nil
+}
+
+const nullabilityStatement = "sql_generator_nullability"
+
+// enableNullabilityInference reports false for servers
+// without plan_cache_mode (before Postgres 12).
+func (b *builder) enableNullabilityInference() bool {
+	return b.conn.Execute("set plan_cache_mode = force_generic_plan") == nil
+}
+
+func (b *builder) explain(body []byte, parameterCount int) (*explainPlan, error) {
+	if err := b.conn.Execute("prepare " + nullabilityStatement + " as " + string(body)); err != nil {
+		return nil, err
+	}
+
+	var query strings.Builder
+	query.WriteString("explain (verbose, format json) execute ")
+	query.WriteString(nullabilityStatement)
+	for i := 0; i < parameterCount; i++ {
+		if i == 0 {
+			query.WriteByte('(')
+		} else {
+			query.WriteString(", ")
+		}
+		query.WriteString("null")
+	}
+	if parameterCount > 0 {
+		query.WriteByte(')')
+	}
+
+	plan, explainErr := b.runExplain(query.String())
+	if err := b.conn.Execute("deallocate " + nullabilityStatement); err != nil {
+		return nil, err
+	}
+	return plan, explainErr
+}
+
+func (b *builder) runExplain(query string) (*explainPlan, error) {
+	if err := b.conn.RunQuery(query); err != nil {
+		return nil, err
+	}
+	var output []byte
+	for b.conn.NextRow() {
+		output = append(output, b.conn.FieldBorrowRawBytes(0)...)
+	}
+	if err := b.conn.CloseQuery(); err != nil {
+		return nil, err
+	}
+	var explained []struct {
+		Plan explainPlan
+	}
+	if err := json.Unmarshal(output, &explained); err != nil {
+		return nil, err
+	}
+	if len(explained) != 1 {
+		return nil, errors.New("unexpected explain output")
+	}
+	return &explained[0].Plan, nil
+}
+
+// inferNullability changes the nullability of fields if the plan
+// of the query allows a definite answer and records the table alias
+// of plain column references. Queries which can not
+// be explained (e.g. utility statements) are not changed.
+func (b *builder) inferNullability(body []byte, parameterCount int, fields []field) error {
+	if !b.nullabilityInference || len(fields) == 0 {
+		return nil
+	}
+	plan, err := b.explain(body, parameterCount)
+	if err != nil {
+		var postgresError *postgres.Error
+		if errors.As(err, &postgresError) {
+			return nil
+		}
+		return fmt.Errorf("nullability inference: %w", err)
+	}
+	analysis := newNullabilityAnalysis(plan, b.columnNotNull)
+	for i, n := range analysis.outputs(len(fields)) {
+		switch n {
+		case nullabilityNullable:
+			fields[i].notNull = false
+		case nullabilityNotNull:
+			fields[i].notNull = true
+		}
+	}
+	for i, alias := range analysis.sources(len(fields)) {
+		fields[i].alias = alias
+	}
+	return nil
+}
+
+func (b *builder) columnNotNull(schema, relation, column string) (notNull bool, ok bool) {
+	relid, ok := b.relations[pgRelationKey{schema: schema, name: relation}]
+	if !ok {
+		return false, false
+	}
+	attr, ok := b.attributesByName[pgAttributeNameKey{relid: relid, name: column}]
+	if !ok {
+		return false, false
+	}
+	return attr.notNull, true
+}
+
+type pgAttributeNameKey struct {
+	relid int
+	name  string
+}
+
+type explainPlan struct {
+	NodeType           string `json:"Node Type"`
+	JoinType           string `json:"Join Type"`
+	ParentRelationship string `json:"Parent Relationship"`
+	RelationName       string `json:"Relation Name"`
+	Schema             string `json:"Schema"`
+	Alias              string `json:"Alias"`
+	Output             []string
+	Plans              []explainPlan
+}
+
+type planAlias struct {
+	schema, relation string // empty if the alias does not reference a table
+	nullable         bool   // nullable side of an outer join
+	ambiguous        bool
+}
+
+type nullabilityAnalysis struct {
+	plan          *explainPlan
+	aliases       map[string]*planAlias
+	columnNotNull func(schema, relation, column string) (notNull bool, ok bool)
+}
+
+func newNullabilityAnalysis(
+	plan *explainPlan,
+	columnNotNull func(schema, relation, column string) (notNull bool, ok bool),
+) *nullabilityAnalysis {
+	a := &nullabilityAnalysis{
+		plan:          plan,
+		aliases:       make(map[string]*planAlias),
+		columnNotNull: columnNotNull,
+	}
+	a.collect(plan)
+	return a
+}
+
+func (a *nullabilityAnalysis) collect(plan *explainPlan) {
+	if plan.Alias != "" {
+		if alias, ok := a.aliases[plan.Alias]; ok {
+			alias.ambiguous = true
+		} else {
+			a.aliases[plan.Alias] = &planAlias{
+				schema:   plan.Schema,
+				relation: plan.RelationName,
+			}
+		}
+	}
+	for i := range plan.Plans {
+		a.collect(&plan.Plans[i])
+	}
+
+	for i := range plan.Plans {
+		child := &plan.Plans[i]
+		switch {
+		case plan.JoinType == "Left" && child.ParentRelationship == "Inner",
+			plan.JoinType == "Right" && child.ParentRelationship == "Outer",
+			plan.JoinType == "Full":
+			a.markNullable(child)
+		}
+	}
+}
+
+func (a *nullabilityAnalysis) markNullable(plan *explainPlan) {
+	if plan.Alias != "" {
+		a.aliases[plan.Alias].nullable = true
+	}
+	for i := range plan.Plans {
+		a.markNullable(&plan.Plans[i])
+	}
+}
+
+// outputs analyzes the first n output expressions,
+// the others are used internally (e.g. for sorting).
+func (a *nullabilityAnalysis) outputs(n int) []nullability {
+	result := make([]nullability, n)
+	if len(a.plan.Output) < n {
+		return result
+	}
+	for i := range result {
+		nodes, ok := parseExpression(a.plan.Output[i])
+		if ok {
+			result[i] = a.expression(nodes)
+		}
+	}
+	return result
+}
+
+// sources returns the table aliases of the first n output expressions,
+// the alias is empty if the expression is not a column of a table.
+func (a *nullabilityAnalysis) sources(n int) []string {
+	result := make([]string, n)
+	if len(a.plan.Output) < n {
+		return result
+	}
+	for i := range result {
+		nodes, ok := parseExpression(a.plan.Output[i])
+		if !ok {
+			continue
+		}
+		nodes = stripCasts(nodes)
+		if len(nodes) != 3 || nodes[1].kind != exprDot || !isIdentifier(nodes[0]) || !isIdentifier(nodes[2]) {
+			continue
+		}
+		alias, ok := a.aliases[nodes[0].text]
+		if ok && !alias.ambiguous && alias.relation != "" {
+			result[i] = nodes[0].text
+		}
+	}
+	return result
+}
+
+type exprTokenKind int
+
+const (
+	exprIdentifier exprTokenKind = iota
+	exprQuotedIdentifier
+	exprString
+	exprNumber
+	exprParameter
+	exprOperator
+	exprComma
+	exprDot
+	exprCast
+	exprGroup // parentheses or brackets, see exprNode.children
+)
+
+// exprNode is a token or a group, unquoted identifiers are lower case.
+type exprNode struct {
+	kind     exprTokenKind
+	text     string
+	children []exprNode
+}
+
+func (n exprNode) isKeyword(keywords ...string) bool {
+	if n.kind != exprIdentifier {
+		return false
+	}
+	for _, keyword := range keywords {
+		if n.text == keyword {
+			return true
+		}
+	}
+	return false
+}
+
+const exprOperatorCharacters = "+-*/<>=~!@#%^&|`?"
+
+// parseExpression tokenizes a deparsed expression and groups
+// parentheses and brackets, reports false if the input is malformed.
+func parseExpression(s string) ([]exprNode, bool) {
+	nodes, rest, ok := parseExpressionGroup(s, 0)
+	return nodes, ok && rest == ""
+}
+
+func parseExpressionGroup(s string, closing byte) ([]exprNode, string, bool) {
+	var nodes []exprNode
+	for {
+		s = strings.TrimLeft(s, " \t\r\n")
+		if s == "" {
+			return nodes, "", closing == 0
+		}
+		ch := s[0]
+		switch {
+		case ch == closing:
+			return nodes, s[1:], true
+		case ch == '(' || ch == '[':
+			closingChild := byte(')')
+			if ch == '[' {
+				closingChild = ']'
+			}
+			children, rest, ok := parseExpressionGroup(s[1:], closingChild)
+			if !ok {
+				return nil, "", false
+			}
+			nodes = append(nodes, exprNode{kind: exprGroup, text: string(ch), children: children})
+			s = rest
+		case ch == ')' || ch == ']':
+			return nil, "", false
+		case ch == '\'' || ((ch == 'E' || ch == 'e') && strings.HasPrefix(s[1:], "'")):
+			start := strings.IndexByte(s, '\'')
+			end, ok := quotedEnd(s[start:], '\'')
+			if !ok {
+				return nil, "", false
+			}
+			nodes = append(nodes, exprNode{kind: exprString, text: s[:start+end]})
+			s = s[start+end:]
+		case ch == '"':
+			end, ok := quotedEnd(s, '"')
+			if !ok {
+				return nil, "", false
+			}
+			text := strings.ReplaceAll(s[1:end-1], `""`, `"`)
+			nodes = append(nodes, exprNode{kind: exprQuotedIdentifier, text: text})
+			s = s[end:]
+		case ch == ',':
+			nodes = append(nodes, exprNode{kind: exprComma, text: ","})
+			s = s[1:]
+		case ch == '.':
+			nodes = append(nodes, exprNode{kind: exprDot, text: "."})
+			s = s[1:]
+		case strings.HasPrefix(s, "::"):
+			nodes = append(nodes, exprNode{kind: exprCast, text: "::"})
+			s = s[2:]
+		case ch == '$':
+			end := 1 + identifierLength(s[1:])
+			nodes = append(nodes, exprNode{kind: exprParameter, text: s[:end]})
+			s = s[end:]
+		case ch >= '0' && ch <= '9':
+			end := identifierLength(s)
+			nodes = append(nodes, exprNode{kind: exprNumber, text: s[:end]})
+			s = s[end:]
+		case strings.IndexByte(exprOperatorCharacters, ch) >= 0 || ch == ':':
+			end := 1
+			for end < len(s) && strings.IndexByte(exprOperatorCharacters, s[end]) >= 0 {
+				end++
+			}
+			nodes = append(nodes, exprNode{kind: exprOperator, text: s[:end]})
+			s = s[end:]
+		default:
+			end := identifierLength(s)
+			if end == 0 {
+				return nil, "", false
+			}
+			nodes = append(nodes, exprNode{kind: exprIdentifier, text: strings.ToLower(s[:end])})
+			s = s[end:]
+		}
+	}
+}
+
+// quotedEnd returns the index after the closing quote,
+// quotes are escaped by doubling them.
+func quotedEnd(s string, quote byte) (int, bool) {
+	for i := 1; i < len(s); i++ {
+		if s[i] != quote {
+			continue
+		}
+		if i+1 < len(s) && s[i+1] == quote {
+			i++
+			continue
+		}
+		return i + 1, true
+	}
+	return 0, false
+}
+
+func identifierLength(s string) int {
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		if ch != '_' && ch != '$' && !(ch >= 'a' && ch <= 'z') && !(ch >= 'A' && ch <= 'Z') &&
+			!(ch >= '0' && ch <= '9') && ch < 0x80 {
+			return i
+		}
+	}
+	return len(s)
+}
+
+var (
+	notNullFunctions = map[string]bool{
+		"count":        true,
+		"row_number":   true,
+		"rank":         true,
+		"dense_rank":   true,
+		"percent_rank": true,
+		"cume_dist":    true,
+		"ntile":        true,
+	}
+	// aggregates return NULL without input rows
+	nullableFunctions = map[string]bool{
+		"sum":              true,
+		"avg":              true,
+		"min":              true,
+		"max":              true,
+		"array_agg":        true,
+		"string_agg":       true,
+		"json_agg":         true,
+		"jsonb_agg":        true,
+		"json_object_agg":  true,
+		"jsonb_object_agg": true,
+		"bool_and":         true,
+		"bool_or":          true,
+		"every":            true,
+		"bit_and":          true,
+		"bit_or":           true,
+		"stddev":           true,
+		"stddev_pop":       true,
+		"stddev_samp":      true,
+		"variance":         true,
+		"var_pop":          true,
+		"var_samp":         true,
+		"lag":              true,
+		"lead":             true,
+		"first_value":      true,
+		"last_value":       true,
+		"nth_value":        true,
+		"nullif":           true,
+	}
+	// the result is NULL only if all arguments are NULL
+	firstNotNullFunctions = map[string]bool{
+		"coalesce": true,
+		"greatest": true,
+		"least":    true,
+	}
+	// operators that might return NULL for non-null operands
+	nullableOperators = map[string]bool{
+		"->":  true,
+		"->>": true,
+		"#>":  true,
+		"#>>": true,
+	}
+)
+
+func (a *nullabilityAnalysis) expression(nodes []exprNode) nullability {
+	nodes = stripCasts(nodes)
+	for len(nodes) == 1 && nodes[0].kind == exprGroup && nodes[0].text == "(" {
+		nodes = stripCasts(nodes[0].children)
+	}
+	if len(nodes) == 0 {
+		return nullabilityUnknown
+	}
+
+	for _, node := range nodes {
+		if node.isKeyword("is") {
+			// IS NULL, IS DISTINCT FROM, IS TRUE, ...
+			return nullabilityNotNull
+		}
+	}
+
+	if nodes[0].isKeyword("case") {
+		return a.caseExpression(nodes)
+	}
+	if n, ok := a.columnReference(nodes); ok {
+		return n
+	}
+	if n, ok := a.functionCall(nodes); ok {
+		return n
+	}
+	if len(nodes) == 1 {
+		node := nodes[0]
+		switch {
+		case node.isKeyword("null"):
+			return nullabilityNullable
+		case node.kind == exprString, node.kind == exprNumber, node.isKeyword("true", "false"):
+			return nullabilityNotNull
+		default:
+			return nullabilityUnknown
+		}
+	}
+	return a.operands(nodes)
+}
+
+// stripCasts removes type casts (e.g. ::character varying(10)[]),
+// they do not change the nullability.
+func stripCasts(nodes []exprNode) []exprNode {
+	var out []exprNode
+	for i := 0; i < len(nodes); i++ {
+		if nodes[i].kind != exprCast {
+			out = append(out, nodes[i])
+			continue
+		}
+		for i+1 < len(nodes) {
+			next := nodes[i+1]
+			typeName := next.kind == exprIdentifier &&
+				!next.isKeyword("and", "or", "not", "is", "when", "then", "else", "end")
+			if !typeName && next.kind != exprQuotedIdentifier && next.kind != exprDot && next.kind != exprGroup {
+				break
+			}
+			i++
+		}
+	}
+	return out
+}
+
+// columnReference handles alias.column.
+func (a *nullabilityAnalysis) columnReference(nodes []exprNode) (nullability, bool) {
+	if len(nodes) != 3 || nodes[1].kind != exprDot || !isIdentifier(nodes[0]) || !isIdentifier(nodes[2]) {
+		return nullabilityUnknown, false
+	}
+	alias, ok := a.aliases[nodes[0].text]
+	if !ok || alias.ambiguous {
+		return nullabilityUnknown, true
+	}
+	if alias.nullable {
+		return nullabilityNullable, true
+	}
+	if alias.relation == "" {
+		return nullabilityUnknown, true
+	}
+	notNull, ok := a.columnNotNull(alias.schema, alias.relation, nodes[2].text)
+	switch {
+	case !ok:
+		return nullabilityUnknown, true
+	case notNull:
+		return nullabilityNotNull, true
+	default:
+		return nullabilityNullable, true
+	}
+}
+
+func isIdentifier(node exprNode) bool {
+	return node.kind == exprIdentifier || node.kind == exprQuotedIdentifier
+}
+
+// functionCall handles name(arguments) and schema.name(arguments),
+// optionally followed by FILTER (...) and OVER ... .
+func (a *nullabilityAnalysis) functionCall(nodes []exprNode) (nullability, bool) {
+	start := 0
+	if len(nodes) >= 4 && isIdentifier(nodes[0]) && nodes[1].kind == exprDot {
+		start = 2
+	}
+	if len(nodes) < start+2 || nodes[start].kind != exprIdentifier ||
+		nodes[start+1].kind != exprGroup || nodes[start+1].text != "(" {
+		return nullabilityUnknown, false
+	}
+	rest := nodes[start+2:]
+	for len(rest) > 0 {
+		switch {
+		case len(rest) >= 2 && rest[0].isKeyword("filter") && rest[1].kind == exprGroup:
+			rest = rest[2:]
+		case len(rest) >= 2 && rest[0].isKeyword("over"):
+			rest = rest[2:]
+		default:
+			return nullabilityUnknown, false
+		}
+	}
+
+	name := nodes[start].text
+	switch {
+	case notNullFunctions[name]:
+		return nullabilityNotNull, true
+	case nullableFunctions[name]:
+		return nullabilityNullable, true
+	}
+
+	arguments := splitNodes(nodes[start+1].children, func(n exprNode) bool {
+		return n.kind == exprComma
+	})
+	if firstNotNullFunctions[name] {
+		result := nullabilityNullable
+		for _, argument := range arguments {
+			switch a.expression(argument) {
+			case nullabilityNotNull:
+				return nullabilityNotNull, true
+			case nullabilityUnknown:
+				result = nullabilityUnknown
+			}
+		}
+		return result, true
+	}
+
+	// most functions are strict, but might return NULL anyway
+	for _, argument := range arguments {
+		if a.expression(argument) == nullabilityNullable {
+			return nullabilityNullable, true
+		}
+	}
+	return nullabilityUnknown, true
+}
+
+// caseExpression is nullable without ELSE or if any result is nullable.
+func (a *nullabilityAnalysis) caseExpression(nodes []exprNode) nullability {
+	if !nodes[len(nodes)-1].isKeyword("end") {
+		return nullabilityUnknown
+	}
+	var results [][]exprNode
+	hasElse := false
+	for i := 1; i < len(nodes)-1; i++ {
+		if !nodes[i].isKeyword("then", "else") {
+			continue
+		}
+		hasElse = hasElse || nodes[i].isKeyword("else")
+		end := i + 1
+		for end < len(nodes) && !nodes[end].isKeyword("when", "else", "end") {
+			end++
+		}
+		results = append(results, nodes[i+1:end])
+		i = end - 1
+	}
+	if !hasElse {
+		return nullabilityNullable
+	}
+	result := nullabilityNotNull
+	for _, r := range results {
+		switch a.expression(r) {
+		case nullabilityNullable:
+			return nullabilityNullable
+		case nullabilityUnknown:
+			result = nullabilityUnknown
+		}
+	}
+	return result
+}
+
+// operands handles e.g. (a + b) or (a AND b), the result is NULL
+// if any operand is NULL.
+func (a *nullabilityAnalysis) operands(nodes []exprNode) nullability {
+	result := nullabilityNotNull
+	operands := splitNodes(nodes, func(n exprNode) bool {
+		if n.kind == exprOperator {
+			if nullableOperators[n.text] {
+				result = nullabilityNullable
+			}
+			return true
+		}
+		return n.isKeyword("and", "or", "not", "like", "ilike", "similar", "to", "between", "in", "escape")
+	})
+	if result == nullabilityNullable {
+		return result
+	}
+	if len(operands) == 1 {
+		// e.g. SubPlan 1
+		return nullabilityUnknown
+	}
+	for _, operand := range operands {
+		if len(operand) == 0 {
+			continue
+		}
+		if last := operand[len(operand)-1]; last.kind == exprGroup && last.text == "[" {
+			// array subscript
+			return nullabilityNullable
+		}
+		switch a.expression(operand) {
+		case nullabilityNullable:
+			return nullabilityNullable
+		case nullabilityUnknown:
+			result = nullabilityUnknown
+		}
+	}
+	return result
+}
+
+func splitNodes(nodes []exprNode, separator func(exprNode) bool) [][]exprNode {
+	var out [][]exprNode
+	start := 0
+	for i, n := range nodes {
+		if separator(n) {
+			out = append(out, nodes[start:i])
+			start = i + 1
+		}
+	}
+	return append(out, nodes[start:])
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+const explainLeftJoin = `[{"Plan": {
+	"Node Type": "Hash Join",
+	"Join Type": "Left",
+	"Output": ["p.id", "p.name", "friend.name", "(p.id + 1)"],
+	"Plans": [
+		{
+			"Node Type": "Seq Scan",
+			"Parent Relationship": "Outer",
+			"Relation Name": "person",
+			"Schema": "public",
+			"Alias": "p",
+			"Output": ["p.id", "p.name", "p.friend_id"]
+		},
+		{
+			"Node Type": "Hash",
+			"Parent Relationship": "Inner",
+			"Output": ["friend.name", "friend.id"],
+			"Plans": [{
+				"Node Type": "Seq Scan",
+				"Parent Relationship": "Outer",
+				"Relation Name": "person",
+				"Schema": "public",
+				"Alias": "friend",
+				"Output": ["friend.name", "friend.id"]
+			}]
+		}
+	]
+}}]`
+
+func TestNullabilityAnalysis(t *testing.T) {
+	var explained []struct {
+		Plan explainPlan
+	}
+	if err := json.Unmarshal([]byte(explainLeftJoin), &explained); err != nil {
+		t.Fatal(err)
+	}
+	columnNotNull := func(schema, relation, column string) (bool, bool) {
+		if schema != "public" || relation != "person" {
+			return false, false
+		}
+		switch column {
+		case "id", "name":
+			return true, true
+		case "friend_id", "nickname":
+			return false, true
+		default:
+			return false, false
+		}
+	}
+	a := newNullabilityAnalysis(&explained[0].Plan, columnNotNull)
+
+	outputs := a.outputs(3)
+	expectedOutputs := []nullability{nullabilityNotNull, nullabilityNotNull, nullabilityNullable}
+	for i := range expectedOutputs {
+		if outputs[i] != expectedOutputs[i] {
+			t.Fatalf("output %d: got %d", i, outputs[i])
+		}
+	}
+
+	sources := a.sources(4)
+	expectedSources := []string{"p", "p", "friend", ""}
+	for i := range expectedSources {
+		if sources[i] != expectedSources[i] {
+			t.Fatalf("source %d: got %q", i, sources[i])
+		}
+	}
+
+	cases := []struct {
+		expr     string
+		expected nullability
+	}{
+		{"p.id", nullabilityNotNull},
+		{"p.friend_id", nullabilityNullable},
+		{"friend.id", nullabilityNullable},
+		{"other.id", nullabilityUnknown},
+		{"count(*)", nullabilityNotNull},
+		{"count(friend.id) FILTER (WHERE (friend.id > 1))", nullabilityNotNull},
+		{"max(p.id)", nullabilityNullable},
+		{"(max(p.id))", nullabilityNullable},
+		{"row_number() OVER (?)", nullabilityNotNull},
+		{"COALESCE(friend.name, 'none'::text)", nullabilityNotNull},
+		{"COALESCE(friend.name, p.nickname)", nullabilityNullable},
+		{"COALESCE(friend.name, lower(p.name))", nullabilityUnknown},
+		{"CASE WHEN (p.id > 1) THEN 'a'::text ELSE p.name END", nullabilityNotNull},
+		{"CASE WHEN (p.id > 1) THEN 'a'::text END", nullabilityNullable},
+		{"CASE p.id WHEN 1 THEN friend.name ELSE 'b'::text END", nullabilityNullable},
+		{"(p.id + 1)", nullabilityNotNull},
+		{"((p.name)::text || (friend.name)::text)", nullabilityNullable},
+		{"(p.data ->> 'key'::text)", nullabilityNullable},
+		{"(friend.id IS NULL)", nullabilityNotNull},
+		{"NULL::text", nullabilityNullable},
+		{"'it''s'::character varying(10)", nullabilityNotNull},
+		{"42", nullabilityNotNull},
+		{"lower(p.name)", nullabilityUnknown},
+		{"lower(friend.name)", nullabilityNullable},
+		{"(SubPlan 1)", nullabilityUnknown},
+		{`"p".id`, nullabilityNotNull},
+	}
+	for _, test := range cases {
+		nodes, ok := parseExpression(test.expr)
+		if !ok {
+			t.Fatalf("%q: parse failed", test.expr)
+		}
+		if got := a.expression(nodes); got != test.expected {
+			t.Fatalf("%q: expected %d, got %d", test.expr, test.expected, got)
+		}
+	}
+
+	for _, invalid := range []string{"(a", "a)", "'a", `"a`} {
+		if _, ok := parseExpression(invalid); ok {
+			t.Fatalf("%q: expected parse failure", invalid)
+		}
+	}
+}
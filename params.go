@@ -0,0 +1,303 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var errMixedParameters = errors.New(
+	"named parameters (@name) can not be mixed with positional parameters ($n)",
+)
+
+// rewriteNamedParameters replaces @name with $n, numbered in the order
+// of first occurrence. The returned names are indexed by n-1,
+// if the body contains no named parameters, names is nil.
+// The offsets map error positions in the rewritten body back to the body.
+//
+// @ directly followed by an identifier is always a named parameter,
+// even where Postgres would read the prefix operator @ (absolute value),
+// e.g. select @x from t. Write @ x or abs(x) for the operator.
+func rewriteNamedParameters(body []byte) ([]byte, []string, bodyOffsets, error) {
+	tokens, err := lexSQL(body)
+	if err != nil {
+		// reported by the server
+		return body, nil, nil, nil
+	}
+
+	hasPositional, hasNamed := false, false
+	for _, tok := range tokens {
+		switch tok.kind {
+		case sqlParameter:
+			hasPositional = true
+		case sqlNamedParameter:
+			hasNamed = true
+		}
+	}
+	if !hasNamed {
+		return body, nil, nil, nil
+	}
+	if hasPositional {
+		return nil, nil, nil, errMixedParameters
+	}
+
+	var names []string
+	var offsets bodyOffsets
+	indexes := make(map[string]int)
+	rewritten := make([]byte, 0, len(body))
+	last := 0
+	for _, tok := range tokens {
+		if tok.kind != sqlNamedParameter {
+			continue
+		}
+		name := string(tok.text(body)[1:])
+		index, ok := indexes[name]
+		if !ok {
+			names = append(names, name)
+			index = len(names)
+			indexes[name] = index
+		}
+		rewritten = append(rewritten, body[last:tok.start]...)
+		start := len(rewritten)
+		rewritten = append(rewritten, '$')
+		rewritten = strconv.AppendInt(rewritten, int64(index), 10)
+		offsets = append(offsets, replacement{
+			start:         start,
+			end:           len(rewritten),
+			originalStart: tok.start,
+			originalEnd:   tok.end,
+		})
+		last = tok.end
+	}
+	rewritten = append(rewritten, body[last:]...)
+	return rewritten, names, offsets, nil
+}
+
+type replacement struct {
+	start, end                 int // in the rewritten body
+	originalStart, originalEnd int
+}
+
+// bodyOffsets are the replacements of the named parameters,
+// sorted by offset.
+type bodyOffsets []replacement
+
+// original converts a byte offset in the rewritten body to the
+// offset in the original body. Offsets inside of a replacement
+// are moved to the start of the named parameter.
+func (offsets bodyOffsets) original(offset int) int {
+	i := sort.Search(len(offsets), func(i int) bool {
+		return offsets[i].start > offset
+	}) - 1
+	if i < 0 {
+		return offset
+	}
+	r := offsets[i]
+	if offset < r.end {
+		return r.originalStart
+	}
+	return r.originalEnd + offset - r.end
+}
+
+// inferParameterNames guesses the names of positional parameters from
+// comparisons like id = $1, from the column list of INSERT ... VALUES
+// and from LIMIT and OFFSET. Unknown or ambiguous names are empty.
+func inferParameterNames(body []byte, count int) []string {
+	names := make([]string, count)
+	tokens, err := lexSQL(body)
+	if err != nil {
+		return names
+	}
+	filtered := tokens[:0]
+	for _, tok := range tokens {
+		if tok.kind != sqlComment {
+			filtered = append(filtered, tok)
+		}
+	}
+	tokens = filtered
+
+	conflicts := make([]bool, count)
+	set := func(index int, name string) {
+		if index < 1 || index > count || name == "" {
+			return
+		}
+		if names[index-1] != "" && names[index-1] != name {
+			conflicts[index-1] = true
+		}
+		names[index-1] = name
+	}
+
+	for i, tok := range tokens {
+		if tok.kind != sqlParameter {
+			continue
+		}
+		index, err := strconv.Atoi(string(tok.text(body)[1:]))
+		if err != nil {
+			continue
+		}
+		set(index, nameBefore(body, tokens[:i]))
+		set(index, nameAfter(body, tokens[i+1:]))
+	}
+	for index, name := range insertParameterNames(body, tokens) {
+		set(index, name)
+	}
+
+	seen := make(map[string]int, count)
+	for i, name := range names {
+		if conflicts[i] {
+			names[i] = ""
+			continue
+		}
+		if name != "" {
+			seen[name]++
+		}
+	}
+	for i, name := range names {
+		if seen[name] > 1 {
+			names[i] = ""
+		}
+	}
+	return names
+}
+
+var comparisonOperators = map[string]bool{
+	"=":  true,
+	"<>": true,
+	"!=": true,
+	"<":  true,
+	"<=": true,
+	">":  true,
+	">=": true,
+}
+
+func identifierName(body []byte, tok sqlToken) string {
+	switch tok.kind {
+	case sqlIdentifier:
+		return strings.ToLower(string(tok.text(body)))
+	case sqlQuotedIdentifier:
+		text := tok.text(body)
+		return string(bytes.ReplaceAll(text[1:len(text)-1], []byte(`""`), []byte(`"`)))
+	default:
+		return ""
+	}
+}
+
+// nameBefore handles [alias.]column <op> $n, LIMIT $n and OFFSET $n.
+func nameBefore(body []byte, tokens []sqlToken) string {
+	if len(tokens) == 0 {
+		return ""
+	}
+	last := tokens[len(tokens)-1]
+	if last.kind == sqlIdentifier {
+		switch keyword := strings.ToLower(string(last.text(body))); keyword {
+		case "limit", "offset":
+			return keyword
+		}
+		return ""
+	}
+	if last.kind != sqlOperator || !comparisonOperators[string(last.text(body))] {
+		return ""
+	}
+	if len(tokens) < 2 {
+		return ""
+	}
+	return identifierName(body, tokens[len(tokens)-2])
+}
+
+// nameAfter handles $n[::type] <op> [alias.]column.
+func nameAfter(body []byte, tokens []sqlToken) string {
+	tokens = skipCast(body, tokens)
+	if len(tokens) < 2 {
+		return ""
+	}
+	if tokens[0].kind != sqlOperator || !comparisonOperators[string(tokens[0].text(body))] {
+		return ""
+	}
+	name := identifierName(body, tokens[1])
+	tokens = tokens[2:]
+	for len(tokens) >= 2 && string(tokens[0].text(body)) == "." {
+		name = identifierName(body, tokens[1])
+		tokens = tokens[2:]
+	}
+	if len(tokens) > 0 && string(tokens[0].text(body)) == "(" {
+		// function call
+		return ""
+	}
+	return name
+}
+
+func skipCast(body []byte, tokens []sqlToken) []sqlToken {
+	if len(tokens) >= 2 && string(tokens[0].text(body)) == "::" {
+		tokens = tokens[2:]
+	}
+	return tokens
+}
+
+// insertParameterNames maps the values of INSERT INTO t (c1, c2)
+// VALUES ($1, $2) to the column names, by parameter index.
+func insertParameterNames(body []byte, tokens []sqlToken) map[int]string {
+	names := make(map[int]string)
+	for i := 0; i < len(tokens); i++ {
+		if tokens[i].kind != sqlIdentifier || !strings.EqualFold(string(tokens[i].text(body)), "insert") {
+			continue
+		}
+		var columns []string
+		j := i + 1
+		for ; j < len(tokens); j++ {
+			if string(tokens[j].text(body)) == "(" {
+				break
+			}
+		}
+		for j++; j < len(tokens) && string(tokens[j].text(body)) != ")"; j++ {
+			if string(tokens[j].text(body)) == "," {
+				continue
+			}
+			columns = append(columns, identifierName(body, tokens[j]))
+		}
+		if j+2 >= len(tokens) ||
+			!strings.EqualFold(string(tokens[j+1].text(body)), "values") ||
+			string(tokens[j+2].text(body)) != "(" {
+			continue
+		}
+
+		values := tokens[j+3:]
+		for column := 0; column < len(columns) && len(values) > 0; column++ {
+			if values[0].kind == sqlParameter {
+				rest := skipCast(body, values[1:])
+				if len(rest) > 0 && (string(rest[0].text(body)) == "," || string(rest[0].text(body)) == ")") {
+					index, err := strconv.Atoi(string(values[0].text(body)[1:]))
+					if err == nil {
+						names[index] = columns[column]
+					}
+				}
+			}
+			values = skipValue(body, values)
+		}
+		i = j
+	}
+	return names
+}
+
+// skipValue skips a single element of a VALUES list including the comma,
+// it returns nil at the end of the list.
+func skipValue(body []byte, tokens []sqlToken) []sqlToken {
+	depth := 0
+	for i, tok := range tokens {
+		switch string(tok.text(body)) {
+		case "(", "[":
+			depth++
+		case ")", "]":
+			if depth == 0 {
+				return nil
+			}
+			depth--
+		case ",":
+			if depth == 0 {
+				return tokens[i+1:]
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestRewriteNamedParameters(t *testing.T) {
+	body := "select * from person where id = @id and name = @name or id = @id and tags <@ '{@x}' -- @comment"
+	rewritten, names, _, err := rewriteNamedParameters([]byte(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "select * from person where id = $1 and name = $2 or id = $1 and tags <@ '{@x}' -- @comment"
+	if string(rewritten) != expected {
+		t.Fatalf("got %q, expected %q", rewritten, expected)
+	}
+	if len(names) != 2 || names[0] != "id" || names[1] != "name" {
+		t.Fatalf("got names %q", names)
+	}
+
+	if _, _, _, err := rewriteNamedParameters([]byte("select @a, $2")); err != errMixedParameters {
+		t.Fatalf("expected errMixedParameters, got %v", err)
+	}
+	rewritten, names, _, err = rewriteNamedParameters([]byte("select $1"))
+	if err != nil || names != nil || string(rewritten) != "select $1" {
+		t.Fatalf("got %q %q %v", rewritten, names, err)
+	}
+
+	// @x is a parameter, not the absolute value operator
+	rewritten, names, _, err = rewriteNamedParameters([]byte("select @x, @ x, @(x) from t"))
+	if err != nil || len(names) != 1 || string(rewritten) != "select $1, @ x, @(x) from t" {
+		t.Fatalf("got %q %q %v", rewritten, names, err)
+	}
+}
+
+func TestBodyOffsets(t *testing.T) {
+	var body strings.Builder
+	body.WriteString("select ")
+	for i := 0; i < 10; i++ {
+		fmt.Fprintf(&body, "@%c, ", 'a'+i)
+	}
+	body.WriteString("@a + missing")
+	rewritten, _, offsets, err := rewriteNamedParameters([]byte(body.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "select $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $1 + missing"
+	if string(rewritten) != expected {
+		t.Fatalf("got %q, expected %q", rewritten, expected)
+	}
+
+	tests := []struct {
+		rewritten string // the offset is at the start of this substring
+		original  string
+	}{
+		{"select", "select"},
+		{"$1,", "@a,"},
+		{"10,", "@j,"}, // inside of a replacement
+		{", $1 +", ", @a +"},
+		{"missing", "missing"},
+	}
+	for _, tt := range tests {
+		offset := offsets.original(strings.Index(expected, tt.rewritten))
+		if got := body.String()[offset:]; !strings.HasPrefix(got, tt.original) {
+			t.Fatalf("%q: got %q, expected %q", tt.rewritten, got, tt.original)
+		}
+	}
+}
+
+func TestInferParameterNames(t *testing.T) {
+	tests := []struct {
+		body     string
+		count    int
+		expected []string
+	}{
+		{"select * from person p where p.id = $1", 1, []string{"id"}},
+		{`select * from person where $1::int8 <> "Id" limit $2 offset $3`, 3, []string{"Id", "limit", "offset"}},
+		{"insert into person (name, age) values ($1, $2::int4)", 2, []string{"name", "age"}},
+		{"insert into person (name, age) values (lower($1), $2)", 2, []string{"", "age"}},
+		{"select * from a join b on a.id = $1 and b.id = $2", 2, []string{"", ""}},
+		{"select * from a where id = $1 or other = $1", 1, []string{""}},
+		{"select $1 = lower(name)", 1, []string{""}},
+	}
+	for _, tt := range tests {
+		names := inferParameterNames([]byte(tt.body), tt.count)
+		if len(names) != len(tt.expected) {
+			t.Fatalf("%q: got %q, expected %q", tt.body, names, tt.expected)
+		}
+		for i := range names {
+			if names[i] != tt.expected[i] {
+				t.Fatalf("%q: got %q, expected %q", tt.body, names, tt.expected)
+			}
+		}
+	}
+}
@@ -4,18 +4,38 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
-	"math"
 	"os"
+	"sort"
+	"strings"
+	"unicode"
 	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
 )
 
 type parser struct {
+	encoding       encoding.Encoding // nil for UTF-8
 	b              bytes.Buffer
 	newlineOffsets []int
+	directives     fileDirectives
 	declarations   []declaration
 }
 
-var errInvalidUtf8 = errors.New("invalid utf8")
+// parseEncoding returns the encoding of the SQL files by name,
+// the files are converted to UTF-8 after reading.
+func parseEncoding(name string) (encoding.Encoding, error) {
+	switch strings.ToLower(name) {
+	case "", "utf-8", "utf8":
+		return nil, nil
+	case "latin1", "latin-1", "iso-8859-1":
+		return charmap.ISO8859_1, nil
+	case "windows-1252", "cp1252":
+		return charmap.Windows1252, nil
+	default:
+		return nil, fmt.Errorf("unknown encoding %q", name)
+	}
+}
 
 func (p *parser) init(path string) error {
 	f, err := os.Open(path)
@@ -28,13 +48,59 @@ func (p *parser) init(path string) error {
 	if _, err := p.b.ReadFrom(f); err != nil {
 		return err
 	}
-	if !utf8.Valid(p.b.Bytes()) {
-		// TODO: get invalid rune position
-		return errInvalidUtf8
+	if p.encoding != nil {
+		decoded, err := p.encoding.NewDecoder().Bytes(p.b.Bytes())
+		if err != nil {
+			return err
+		}
+		p.b.Reset()
+		p.b.Write(decoded)
 	}
 	// TODO: check against cache? -> sum := sha256.Sum256(b.Bytes())
 	p.calculateNewlineOffsets()
-	return nil
+	return p.checkUTF8()
+}
+
+// checkUTF8 reports the position of the first invalid byte sequence
+// with the surrounding bytes in hex, the invalid byte is in brackets.
+func (p *parser) checkUTF8() error {
+	b := p.b.Bytes()
+	offset := 0
+	for offset < len(b) {
+		r, size := utf8.DecodeRune(b[offset:])
+		if r == utf8.RuneError && size == 1 {
+			break
+		}
+		offset += size
+	}
+	if offset == len(b) {
+		return nil
+	}
+
+	lineIndex := p.lineIndexAt(offset)
+	from, _ := p.lineAtRange(lineIndex)
+	var snippet strings.Builder
+	for i := offset - 4; i <= offset+4; i++ {
+		if i < 0 || i >= len(b) {
+			continue
+		}
+		if snippet.Len() > 0 {
+			snippet.WriteByte(' ')
+		}
+		if i == offset {
+			fmt.Fprintf(&snippet, "[%02x]", b[i])
+		} else {
+			fmt.Fprintf(&snippet, "%02x", b[i])
+		}
+	}
+	return &parserError{
+		line: lineIndex + 1,
+		msg: fmt.Sprintf(
+			"column %d: invalid UTF-8 (%s), set Encoding in the config for other encodings",
+			utf8.RuneCount(b[from:offset])+1,
+			snippet.String(),
+		),
+	}
 }
 
 func (p *parser) calculateNewlineOffsets() {
@@ -62,12 +128,6 @@ func (p *parser) lineAt(index int) []byte {
 	return p.b.Bytes()[from:to]
 }
 
-func (p *parser) lineSlice(from, toInclusive int) []byte {
-	sliceFrom, _ := p.lineAtRange(from)
-	_, sliceTo := p.lineAtRange(toInclusive)
-	return p.b.Bytes()[sliceFrom:sliceTo]
-}
-
 func (p *parser) lineAtRange(index int) (from, to int) {
 	if index < 0 || index > len(p.newlineOffsets) {
 		panic(errLineIndexOutOfBounds)
@@ -100,159 +160,71 @@ func (e *parserError) Error() string {
 
 const headerStartComment = "--- "
 
+// lineIndexAt returns the index of the line containing the byte offset.
+func (p *parser) lineIndexAt(offset int) int {
+	return sort.SearchInts(p.newlineOffsets, offset)
+}
+
 func (p *parser) buildRawDeclarations() error {
-	// We try to handle comments and strings in a database general way.
-	// Double and single quotes can span multiple lines. Repetition esacpes them.
-	// Block comments can not be nested, but line comments can.
-	// Block comments can contain line comments.
-	// Whatever comes first takes precedence over the rest.
+	// The file is split into Postgres tokens, so strings (including
+	// dollar quoted function bodies) and nested block comments
+	// can contain lines looking like headers or blank lines.
+	// Only line comments starting a line can start a declaration.
+
+	tokens, err := lexSQL(p.b.Bytes())
+	if err != nil {
+		var lexErr *lexError
+		if !errors.As(err, &lexErr) {
+			panic("internal error")
+		}
+		return &parserError{line: p.lineIndexAt(lexErr.offset) + 1, msg: lexErr.Error()}
+	}
 
 	p.declarations = p.declarations[:0]
 	insideDeclarationBlock := false
-	state := markerNone
-	lastMarkerLineIndex := -1 // for error reporting
-
+	tokenIndex := 0
 	for lineIndex := 0; lineIndex < p.lineCount(); lineIndex++ {
+		from, _ := p.lineAtRange(lineIndex)
 		line := p.lineAt(lineIndex)
-		trimmed := bytes.TrimSpace(line)
-
-		if insideDeclarationBlock && len(trimmed) == 0 {
-			p.declarations[len(p.declarations)-1].endLineIndex = lineIndex
-			insideDeclarationBlock = false
+		for tokenIndex < len(tokens) && tokens[tokenIndex].end <= from {
+			tokenIndex++
+		}
+		if tokenIndex < len(tokens) && tokens[tokenIndex].start < from {
+			// continued string or comment
 			continue
 		}
 
-		remainder := line
-		for {
-			if len(remainder) == 0 {
-				break
-			}
-
-			switch state {
-			case markerNone:
-				m, pos := getFirstMarker(remainder)
-				if m == markerNone {
-					remainder = nil
-				} else {
-					state, remainder = m, remainder[pos+1:]
-					lastMarkerLineIndex = lineIndex
-				}
-			case markerSingleQuote:
-				newRemainder, stateChange := nextQuoted(remainder, '\'')
-				remainder = newRemainder
-				if stateChange {
-					state = markerNone
-				}
-			case markerDoubleQuote:
-				newRemainder, stateChange := nextQuoted(remainder, '"')
-				remainder = newRemainder
-				if stateChange {
-					state = markerNone
-				}
-			case markerLineComment:
-				isDeclaration := len(trimmed) >= len(headerStartComment) &&
-					string(trimmed[:len(headerStartComment)]) == headerStartComment
-				if isDeclaration {
-					if insideDeclarationBlock {
-						return &parserError{
-							line: lineIndex + 1,
-							msg:  "declaration blocks must be separated by a blank line",
-						}
-					}
-					p.declarations = append(p.declarations, declaration{
-						startLineIndex: lineIndex,
-						endLineIndex:   p.lineCount() - 1,
-						header:         bytes.TrimSpace(trimmed[len(headerStartComment):]),
-					})
-					insideDeclarationBlock = true
-				}
-				state = markerNone
-				remainder = nil
-			case markerBlockCommentStart:
-				blockCommentEndIndex := bytes.Index(remainder, []byte("*\\"))
-				if blockCommentEndIndex < 0 {
-					remainder = nil
-				} else {
-					state = markerNone
-					remainder = remainder[blockCommentEndIndex+2:]
-				}
-			default:
-				panic("unreachable")
+		trimmed := bytes.TrimSpace(line)
+		if len(trimmed) == 0 {
+			if insideDeclarationBlock {
+				p.declarations[len(p.declarations)-1].endLineIndex = lineIndex
+				insideDeclarationBlock = false
 			}
+			continue
 		}
-	}
 
-	switch state {
-	case markerNone:
-		return nil
-	case markerSingleQuote:
-		return &parserError{
-			line: lastMarkerLineIndex + 1,
-			msg:  "unterminated single quote `'`",
-		}
-	case markerDoubleQuote:
-		return &parserError{
-			line: lastMarkerLineIndex + 1,
-			msg:  "unterminated double quote `\"`",
-		}
-	case markerLineComment:
-		panic("unreachable")
-	case markerBlockCommentStart:
-		return &parserError{
-			line: lastMarkerLineIndex + 1,
-			msg:  "unterminated block comment `/*`",
+		indentation := len(line) - len(bytes.TrimLeftFunc(line, unicode.IsSpace))
+		isDeclaration := tokenIndex < len(tokens) &&
+			tokens[tokenIndex].kind == sqlComment &&
+			tokens[tokenIndex].start == from+indentation &&
+			bytes.HasPrefix(trimmed, []byte(headerStartComment))
+		if !isDeclaration {
+			continue
 		}
-	default:
-		panic("unreachable")
-	}
-}
-
-type marker int
-
-const (
-	markerNone marker = iota
-	markerSingleQuote
-	markerDoubleQuote
-	markerLineComment
-	markerBlockCommentStart
-)
-
-func getFirstMarker(remainder []byte) (marker, int) {
-	markers := [...]struct {
-		m     marker
-		index int
-	}{
-		{markerSingleQuote, bytes.IndexByte(remainder, '\'')},
-		{markerDoubleQuote, bytes.IndexByte(remainder, '"')},
-		{markerLineComment, bytes.Index(remainder, []byte("--"))},
-		{markerBlockCommentStart, bytes.Index(remainder, []byte("\\*"))},
-	}
-
-	selected := markerNone
-	firstIndex := math.MaxInt
-	for _, m := range markers {
-		if m.index >= 0 && m.index < firstIndex {
-			selected = m.m
-			firstIndex = m.index
+		if insideDeclarationBlock {
+			return &parserError{
+				line: lineIndex + 1,
+				msg:  "declaration blocks must be separated by a blank line",
+			}
 		}
+		header := bytes.TrimSpace(trimmed[len(headerStartComment):])
+		p.declarations = append(p.declarations, declaration{
+			startLineIndex: lineIndex,
+			endLineIndex:   p.lineCount() - 1,
+			header:         header,
+			headerOffset:   utf8.RuneCount(line[:indentation]) + utf8.RuneCount(trimmed[:len(trimmed)-len(header)]),
+		})
+		insideDeclarationBlock = true
 	}
-
-	return selected, firstIndex
-}
-
-func nextQuoted(remainder []byte, quote byte) (newRemainder []byte, stateChange bool) {
-	index := bytes.IndexByte(remainder, quote)
-	if index < 0 {
-		return nil, false
-	}
-	isLast := index == len(remainder)-1
-	if isLast {
-		return nil, true
-	}
-	escaped := remainder[index+1] == quote
-	if escaped {
-		return remainder[index+2:], false
-	} else {
-		return remainder[index+1:], true
-	}
+	return nil
 }
@@ -1,6 +1,10 @@
 package main
 
 import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -31,3 +35,60 @@ func TestLineAt(t *testing.T) {
 		}
 	}
 }
+
+func TestBuildRawDeclarations(t *testing.T) {
+	paths, err := filepath.Glob(filepath.Join("testdata", "parser", "*.sql"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) == 0 {
+		t.Fatal("empty corpus")
+	}
+	for _, path := range paths {
+		var p parser
+		if err := p.init(path); err != nil {
+			t.Fatal(err)
+		}
+		var got strings.Builder
+		if err := p.buildRawDeclarations(); err != nil {
+			fmt.Fprintf(&got, "error: %v\n", err)
+		} else {
+			for _, decl := range p.declarations {
+				fmt.Fprintf(&got, "%d-%d %s\n", decl.startLineIndex+1, decl.endLineIndex+1, decl.header)
+			}
+		}
+
+		expected, err := os.ReadFile(strings.TrimSuffix(path, ".sql") + ".golden")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.String() != string(expected) {
+			t.Fatalf("%s: got\n%s\nexpected\n%s", path, got.String(), expected)
+		}
+	}
+}
+
+func TestInitEncoding(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "latin1.sql")
+	if err := os.WriteFile(path, []byte("select 1\nselect 'gr\xfc\xdfe'\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var p parser
+	err := p.init(path)
+	expected := "line 2: column 11: invalid UTF-8 (20 27 67 72 [fc] df 65 27 0a), set Encoding in the config for other encodings"
+	if err == nil || err.Error() != expected {
+		t.Fatalf("got %v, expected %s", err, expected)
+	}
+
+	p.encoding, err = parseEncoding("latin1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.init(path); err != nil {
+		t.Fatal(err)
+	}
+	if got := string(p.lineAt(1)); got != "select 'grüße'\n" {
+		t.Fatalf("got %q", got)
+	}
+}
@@ -1,8 +1,7 @@
 /*
 TODO:
 - batch queries -> postgres Copy -> execMany
-- specify input type of queries?
-- output / input of non generated type
+- input of non generated type
 */
 
 /*
@@ -21,7 +20,18 @@ if known: schema, table, column
 -> only used to figure out if the value is nullable
 -> if not known we assume NOT NULL (checked), override with comment
 
-type overrides not supported (for now), because interop parameters <-> columns
+type overrides in the header: ($1: person.ID, name: null) for parameters,
+{id: person.ID, 2: notnull time.Time} for columns
+
+parameters are named with @name in the body (rewritten to $n),
+otherwise the name is inferred from comparisons like id = $1
+
+GetUser -> example.com/app/models.User scans into an existing struct,
+columns are matched to the fields by the sql tag or by name
+
+!InsertPerson <- NewPerson passes the parameters as a single struct,
+fields are named after the parameters, NewPerson is generated unless
+it is a Go type like example.com/person.New
 
 if name differs from as, we use that as the name,
 but where we store that in the result struct?
@@ -56,7 +66,7 @@ GetFoo -> Foo?
 for column nullability options see original idea
 */
 
---- GetNameAndFriendName -> NameAndFriendName? {1: notnull, fname: null}
+--- GetNameAndFriendName -> NameAndFriendName? {1: notnull, fname: null} nested
 -- or dml (only returns an error),
 -- many (returns an iterator of the type with an error each and a normal error)
 select p.id, p.name, friend.name as fname
@@ -65,8 +75,9 @@ join person as friend on friend.id = p.friend_id
 where p.id = $1;
 
 /*
+with nested, columns are grouped by table (or by alias if a table is used multiple times):
 type NameAndFriendName struct {
-    Person struct {
+    P struct {
         ID   person.ID
         Name string
     }
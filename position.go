@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/width"
+)
+
+// Error positions are shown with the line and a caret below.
+// Tabs are expanded, combining characters take no space,
+// wide characters (e.g. CJK) take two columns.
+
+const tabWidth = 8
+
+const zeroWidthJoiner = '\u200d'
+
+// characterOffset returns the byte offset of the character
+// at the position, which starts at 1 (like Postgres error positions).
+func characterOffset(s []byte, position int) (int, bool) {
+	if position < 1 {
+		return 0, false
+	}
+	for offset := range string(s) {
+		position--
+		if position == 0 {
+			return offset, true
+		}
+	}
+	if position == 1 {
+		// directly after the last character
+		return len(s), true
+	}
+	return 0, false
+}
+
+func isZeroWidth(r rune) bool {
+	return unicode.In(r, unicode.Mn, unicode.Me, unicode.Cf) ||
+		(r >= 0x1f3fb && r <= 0x1f3ff) // emoji skin tone modifiers
+}
+
+func runeWidth(r rune) int {
+	if isZeroWidth(r) {
+		return 0
+	}
+	switch width.LookupRune(r).Kind() {
+	case width.EastAsianWide, width.EastAsianFullwidth:
+		return 2
+	}
+	return 1
+}
+
+// graphemeStart moves the offset back to the start of the
+// user perceived character (base character and combining characters,
+// emoji joined with a zero width joiner).
+func graphemeStart(line []byte, offset int) int {
+	for offset > 0 && offset < len(line) {
+		r, _ := utf8.DecodeRune(line[offset:])
+		previous, size := utf8.DecodeLastRune(line[:offset])
+		if !isZeroWidth(r) && previous != zeroWidthJoiner {
+			break
+		}
+		offset -= size
+	}
+	return offset
+}
+
+// displayLine expands the tabs of the line and returns
+// the column of the byte offset.
+func displayLine(line []byte, offset int) (string, int) {
+	var b strings.Builder
+	column, offsetColumn := 0, -1
+	previous := rune(-1)
+	for i, r := range string(line) {
+		if i == offset {
+			offsetColumn = column
+		}
+		switch {
+		case r == '\t':
+			spaces := tabWidth - column%tabWidth
+			b.WriteString(strings.Repeat(" ", spaces))
+			column += spaces
+		case previous == zeroWidthJoiner:
+			b.WriteRune(r)
+		default:
+			b.WriteRune(r)
+			column += runeWidth(r)
+		}
+		previous = r
+	}
+	if offsetColumn < 0 {
+		offsetColumn = column + (offset - len(line))
+	}
+	return b.String(), offsetColumn
+}
+
+// formatErrorAt shows the line containing the byte offset.
+func formatErrorAt(text []byte, offset int) string {
+	from := bytes.LastIndexByte(text[:offset], '\n') + 1
+	to := len(text)
+	if i := bytes.IndexByte(text[offset:], '\n'); i >= 0 {
+		to = offset + i
+	}
+	lineIndex := bytes.Count(text[:from], []byte("\n"))
+	return formatErrorLine(text[from:to], lineIndex, offset-from)
+}
+
+// formatErrorLine shows the line with a caret below the byte offset.
+func formatErrorLine(line []byte, lineIndex, offset int) string {
+	line = bytes.TrimRightFunc(line, unicode.IsSpace)
+	text, column := displayLine(line, graphemeStart(line, offset))
+
+	var b strings.Builder
+	lineNumber := strconv.Itoa(lineIndex + 1)
+	b.WriteString(lineNumber)
+	b.WriteString(" | ")
+	b.WriteString(text)
+	b.WriteByte('\n')
+	b.WriteString(strings.Repeat(" ", len(lineNumber)))
+	b.WriteString(" | ")
+	b.WriteString(strings.Repeat(" ", column))
+	b.WriteByte('^')
+	return b.String()
+}
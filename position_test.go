@@ -0,0 +1,35 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestFormatErrorAt(t *testing.T) {
+	tests := []struct {
+		text     string
+		position int // characters, starting at 1
+		expected string
+	}{
+		{"select x", 8, "1 | select x\n  |        ^"},
+		{"select 1\nfrom\tt", 15, "2 | from    t\n  |         ^"},
+		{"\tselect 'ä' x", 13, "1 |         select 'ä' x\n  |                    ^"},
+		{"select '日本' x", 12, "1 | select '日本' x\n  |              ^"},
+		{"select 'e\u0301' x", 10, "1 | select 'e\u0301' x\n  |         ^"},
+		{"select 'e\u0301' x", 13, "1 | select 'e\u0301' x\n  |            ^"},
+		{"select x   ", 12, "1 | select x\n  |            ^"},
+	}
+	for _, tt := range tests {
+		offset, ok := characterOffset([]byte(tt.text), tt.position)
+		if !ok {
+			t.Fatalf("%q: position %d out of range", tt.text, tt.position)
+		}
+		got := formatErrorAt([]byte(tt.text), offset)
+		if got != tt.expected {
+			t.Fatalf("%q: got\n%s\nexpected\n%s", tt.text, got, tt.expected)
+		}
+	}
+
+	if _, ok := characterOffset([]byte("ab"), 4); ok {
+		t.Fatal("expected out of range")
+	}
+}
@@ -0,0 +1,530 @@
+package postgres
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// RawValue is a possibly NULL element of an array or composite value.
+// The format matches the format of the surrounding value.
+type RawValue struct {
+	IsNull bool
+	Value  []byte
+}
+
+type ArrayDimension struct {
+	Length     int
+	LowerBound int
+}
+
+// Array is the generic representation of an array value.
+// Elements are stored in row-major order, an empty array has no dimensions.
+type Array struct {
+	Dimensions []ArrayDimension
+	ElementOid int // only known with the binary format
+	Elements   []RawValue
+}
+
+var (
+	errInvalidArray           = errors.New("invalid array")
+	errArrayNotOneDimensional = errors.New("array has more than one dimension")
+	errArrayDimensions        = errors.New("array dimensions do not match the elements")
+)
+
+// ParseArray parses the text or binary format of an array.
+// delim is the element delimiter of the element type (pg_type.typdelim),
+// it is only used with the text format.
+// Element values might reference b.
+func ParseArray(format int, b []byte, delim byte) (Array, error) {
+	switch format {
+	case FormatText:
+		p := arrayTextParser{b: b, delim: delim, leafDepth: -1}
+		return p.parse()
+	case FormatBinary:
+		return parseArrayBinary(b)
+	default:
+		return Array{}, errUnknownFormat
+	}
+}
+
+type arrayTextParser struct {
+	b     []byte
+	pos   int
+	delim byte
+
+	lengths   []int // per depth, -1 if unknown
+	leafDepth int   // depth of the elements, -1 if unknown
+	elements  []RawValue
+}
+
+func (p *arrayTextParser) parse() (Array, error) {
+	var a Array
+	p.skipSpace()
+
+	// optional dimension decoration, e.g. [1:3][0:1]=
+	var lowerBounds []int
+	if p.peek() == '[' {
+		for p.peek() == '[' {
+			p.pos++
+			lower, ok := p.integer()
+			if !ok || p.next() != ':' {
+				return Array{}, errInvalidArray
+			}
+			upper, ok := p.integer()
+			if !ok || p.next() != ']' || upper < lower {
+				return Array{}, errInvalidArray
+			}
+			a.Dimensions = append(a.Dimensions, ArrayDimension{
+				Length:     upper - lower + 1,
+				LowerBound: lower,
+			})
+			lowerBounds = append(lowerBounds, lower)
+		}
+		if p.next() != '=' {
+			return Array{}, errInvalidArray
+		}
+		p.skipSpace()
+	}
+
+	if p.next() != '{' {
+		return Array{}, errInvalidArray
+	}
+	if err := p.parseLevel(0); err != nil {
+		return Array{}, err
+	}
+	p.skipSpace()
+	if p.pos != len(p.b) {
+		return Array{}, errInvalidArray
+	}
+
+	a.Elements = p.elements
+	if len(p.elements) == 0 {
+		if len(lowerBounds) != 0 {
+			return Array{}, errArrayDimensions
+		}
+		return a, nil
+	}
+	if lowerBounds != nil {
+		if len(a.Dimensions) != len(p.lengths) {
+			return Array{}, errArrayDimensions
+		}
+		for i, l := range p.lengths {
+			if a.Dimensions[i].Length != l {
+				return Array{}, errArrayDimensions
+			}
+		}
+		return a, nil
+	}
+	for _, l := range p.lengths {
+		a.Dimensions = append(a.Dimensions, ArrayDimension{Length: l, LowerBound: 1})
+	}
+	return a, nil
+}
+
+// parseLevel is called after the opening brace at depth.
+func (p *arrayTextParser) parseLevel(depth int) error {
+	if depth >= len(p.lengths) {
+		p.lengths = append(p.lengths, -1)
+	}
+	p.skipSpace()
+	if p.peek() == '}' {
+		p.pos++
+		if depth != 0 || len(p.elements) != 0 {
+			// empty sub arrays are not allowed
+			return errInvalidArray
+		}
+		p.lengths = p.lengths[:0]
+		return nil
+	}
+
+	length := 0
+	for {
+		p.skipSpace()
+		if p.peek() == '{' {
+			p.pos++
+			if p.leafDepth >= 0 && p.leafDepth <= depth {
+				return errArrayDimensions
+			}
+			if err := p.parseLevel(depth + 1); err != nil {
+				return err
+			}
+		} else {
+			if p.leafDepth >= 0 && p.leafDepth != depth {
+				return errArrayDimensions
+			}
+			p.leafDepth = depth
+			value, err := p.element()
+			if err != nil {
+				return err
+			}
+			p.elements = append(p.elements, value)
+		}
+		length++
+
+		p.skipSpace()
+		switch p.next() {
+		case p.delim:
+			continue
+		case '}':
+			if p.lengths[depth] >= 0 && p.lengths[depth] != length {
+				return errArrayDimensions
+			}
+			p.lengths[depth] = length
+			return nil
+		default:
+			return errInvalidArray
+		}
+	}
+}
+
+func (p *arrayTextParser) element() (RawValue, error) {
+	if p.peek() == '"' {
+		p.pos++
+		var value []byte
+		for {
+			if p.pos >= len(p.b) {
+				return RawValue{}, errInvalidArray
+			}
+			ch := p.b[p.pos]
+			p.pos++
+			switch ch {
+			case '"':
+				return RawValue{Value: value}, nil
+			case '\\':
+				if p.pos >= len(p.b) {
+					return RawValue{}, errInvalidArray
+				}
+				value = append(value, p.b[p.pos])
+				p.pos++
+			default:
+				value = append(value, ch)
+			}
+		}
+	}
+
+	start := p.pos
+	escaped := false
+	var value []byte
+	for p.pos < len(p.b) {
+		ch := p.b[p.pos]
+		if ch == p.delim || ch == '}' || ch == '{' || ch == '"' {
+			break
+		}
+		p.pos++
+		if ch == '\\' {
+			if p.pos >= len(p.b) {
+				return RawValue{}, errInvalidArray
+			}
+			escaped = true
+			ch = p.b[p.pos]
+			p.pos++
+		}
+		value = append(value, ch)
+	}
+	if p.pos == start {
+		return RawValue{}, errInvalidArray
+	}
+	if !escaped {
+		value = bytes.TrimRight(p.b[start:p.pos], " \t\n\r\v\f")
+		if len(value) == 4 && bytes.EqualFold(value, []byte("NULL")) {
+			return RawValue{IsNull: true}, nil
+		}
+	}
+	return RawValue{Value: value}, nil
+}
+
+func (p *arrayTextParser) integer() (int, bool) {
+	negative := p.peek() == '-'
+	if negative {
+		p.pos++
+	}
+	start := p.pos
+	for p.pos < len(p.b) && p.b[p.pos] >= '0' && p.b[p.pos] <= '9' {
+		p.pos++
+	}
+	n, ok := parseDigits(string(p.b[start:p.pos]))
+	if negative {
+		n = -n
+	}
+	return n, ok
+}
+
+func (p *arrayTextParser) skipSpace() {
+	for p.pos < len(p.b) {
+		switch p.b[p.pos] {
+		case ' ', '\t', '\n', '\r', '\v', '\f':
+			p.pos++
+		default:
+			return
+		}
+	}
+}
+
+func (p *arrayTextParser) peek() byte {
+	if p.pos >= len(p.b) {
+		return 0
+	}
+	return p.b[p.pos]
+}
+
+func (p *arrayTextParser) next() byte {
+	ch := p.peek()
+	p.pos++
+	return ch
+}
+
+func parseArrayBinary(b []byte) (Array, error) {
+	r := binaryValueReader{b: b}
+	ndim := r.int32()
+	_ = r.int32() // has nulls flag
+	elementOid := r.int32()
+	if r.err != nil || ndim < 0 {
+		return Array{}, errInvalidArray
+	}
+
+	a := Array{ElementOid: elementOid}
+	count := 1
+	if ndim == 0 {
+		count = 0
+	}
+	for i := 0; i < ndim; i++ {
+		length, lowerBound := r.int32(), r.int32()
+		if r.err != nil || length < 0 {
+			return Array{}, errInvalidArray
+		}
+		a.Dimensions = append(a.Dimensions, ArrayDimension{
+			Length:     length,
+			LowerBound: lowerBound,
+		})
+		count *= length
+		if count > len(b) {
+			// every element needs at least its length
+			return Array{}, errInvalidArray
+		}
+	}
+
+	a.Elements = make([]RawValue, count)
+	for i := range a.Elements {
+		a.Elements[i] = r.value()
+	}
+	if r.err != nil || len(r.b) != 0 {
+		return Array{}, errInvalidArray
+	}
+	return a, nil
+}
+
+// binaryValueReader reads the binary format of arrays and records,
+// the first error is sticky.
+type binaryValueReader struct {
+	b   []byte
+	err error
+}
+
+func (r *binaryValueReader) int32() int {
+	if r.err != nil {
+		return 0
+	}
+	if len(r.b) < 4 {
+		r.err = errInvalidLength
+		return 0
+	}
+	n := int(int32(binary.BigEndian.Uint32(r.b)))
+	r.b = r.b[4:]
+	return n
+}
+
+func (r *binaryValueReader) value() RawValue {
+	length := r.int32()
+	if r.err != nil {
+		return RawValue{}
+	}
+	if length < 0 {
+		return RawValue{IsNull: true}
+	}
+	if len(r.b) < length {
+		r.err = errInvalidLength
+		return RawValue{}
+	}
+	value := r.b[:length]
+	r.b = r.b[length:]
+	return RawValue{Value: value}
+}
+
+// DecodeArray decodes an array with at most one dimension into a slice.
+// NULL elements are rejected with ErrNullValue,
+// use ParseArray for multiple dimensions or NULL elements.
+func DecodeArray[T any](
+	format int,
+	b []byte,
+	delim byte,
+	decode func(format int, b []byte) (T, error),
+) ([]T, error) {
+	a, err := ParseArray(format, b, delim)
+	if err != nil {
+		return nil, err
+	}
+	if len(a.Dimensions) > 1 {
+		return nil, errArrayNotOneDimensional
+	}
+	out := make([]T, len(a.Elements))
+	for i, element := range a.Elements {
+		if element.IsNull {
+			return nil, fmt.Errorf("array element %d: %w", i, ErrNullValue)
+		}
+		value, err := decode(format, element.Value)
+		if err != nil {
+			return nil, fmt.Errorf("array element %d: %w", i, err)
+		}
+		out[i] = value
+	}
+	return out, nil
+}
+
+// FieldArray is the equivalent of the Field methods for DecodeArray.
+func FieldArray[T any](
+	c *Conn,
+	index int,
+	delim byte,
+	decode func(format int, b []byte) (T, error),
+) ([]T, error) {
+	return fieldDecode(c, index, func(format int, b []byte) ([]T, error) {
+		return DecodeArray(format, b, delim, decode)
+	})
+}
+
+func FieldMaybeArray[T any](
+	c *Conn,
+	index int,
+	delim byte,
+	decode func(format int, b []byte) (T, error),
+) ([]T, bool, error) {
+	return fieldDecodeMaybe(c, index, func(format int, b []byte) ([]T, error) {
+		return DecodeArray(format, b, delim, decode)
+	})
+}
+
+// AppendArray appends the text format of a one dimensional array,
+// appendElement must append the text format of a single element.
+func AppendArray[T any](
+	b []byte,
+	elements []T,
+	delim byte,
+	appendElement func(b []byte, v T) []byte,
+) []byte {
+	var scratch []byte
+	b = append(b, '{')
+	for i, element := range elements {
+		if i != 0 {
+			b = append(b, delim)
+		}
+		scratch = appendElement(scratch[:0], element)
+		b = appendArrayQuoted(b, scratch)
+	}
+	return append(b, '}')
+}
+
+func appendArrayQuoted(b []byte, value []byte) []byte {
+	b = append(b, '"')
+	for _, ch := range value {
+		if ch == '"' || ch == '\\' {
+			b = append(b, '\\')
+		}
+		b = append(b, ch)
+	}
+	return append(b, '"')
+}
+
+func (a *Array) checkDimensions() error {
+	count := 1
+	if len(a.Dimensions) == 0 {
+		count = 0
+	}
+	for _, d := range a.Dimensions {
+		count *= d.Length
+	}
+	if count != len(a.Elements) {
+		return errArrayDimensions
+	}
+	return nil
+}
+
+// AppendText appends the text format, the element values must be in the text format.
+func (a *Array) AppendText(b []byte, delim byte) ([]byte, error) {
+	if err := a.checkDimensions(); err != nil {
+		return b, err
+	}
+	if len(a.Dimensions) == 0 {
+		return append(b, "{}"...), nil
+	}
+
+	needsDecoration := false
+	for _, d := range a.Dimensions {
+		if d.LowerBound != 1 {
+			needsDecoration = true
+		}
+	}
+	if needsDecoration {
+		for _, d := range a.Dimensions {
+			b = fmt.Appendf(b, "[%d:%d]", d.LowerBound, d.LowerBound+d.Length-1)
+		}
+		b = append(b, '=')
+	}
+
+	elements := a.Elements
+	var appendLevel func(depth int)
+	appendLevel = func(depth int) {
+		b = append(b, '{')
+		for i := 0; i < a.Dimensions[depth].Length; i++ {
+			if i != 0 {
+				b = append(b, delim)
+			}
+			if depth+1 < len(a.Dimensions) {
+				appendLevel(depth + 1)
+				continue
+			}
+			if elements[0].IsNull {
+				b = append(b, "NULL"...)
+			} else {
+				b = appendArrayQuoted(b, elements[0].Value)
+			}
+			elements = elements[1:]
+		}
+		b = append(b, '}')
+	}
+	appendLevel(0)
+	return b, nil
+}
+
+// AppendBinary appends the binary format, the element values must be in the binary format.
+func (a *Array) AppendBinary(b []byte) ([]byte, error) {
+	if err := a.checkDimensions(); err != nil {
+		return b, err
+	}
+	hasNulls := 0
+	for _, element := range a.Elements {
+		if element.IsNull {
+			hasNulls = 1
+		}
+	}
+	b = binary.BigEndian.AppendUint32(b, uint32(len(a.Dimensions)))
+	b = binary.BigEndian.AppendUint32(b, uint32(hasNulls))
+	b = binary.BigEndian.AppendUint32(b, uint32(a.ElementOid))
+	for _, d := range a.Dimensions {
+		b = binary.BigEndian.AppendUint32(b, uint32(d.Length))
+		b = binary.BigEndian.AppendUint32(b, uint32(d.LowerBound))
+	}
+	for _, element := range a.Elements {
+		b = appendRawValueBinary(b, element)
+	}
+	return b, nil
+}
+
+func appendRawValueBinary(b []byte, value RawValue) []byte {
+	if value.IsNull {
+		return binary.BigEndian.AppendUint32(b, 0xFFFFFFFF)
+	}
+	b = binary.BigEndian.AppendUint32(b, uint32(len(value.Value)))
+	return append(b, value.Value...)
+}
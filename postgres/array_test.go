@@ -0,0 +1,84 @@
+package postgres
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseArrayText(t *testing.T) {
+	cases := []struct {
+		input      string
+		delim      byte
+		dimensions []ArrayDimension
+		elements   []RawValue
+	}{
+		{"{}", ',', nil, nil},
+		{
+			`{1,NULL, "NULL" ,"a\"b"}`, ',',
+			[]ArrayDimension{{4, 1}},
+			[]RawValue{{Value: []byte("1")}, {IsNull: true}, {Value: []byte("NULL")}, {Value: []byte(`a"b`)}},
+		},
+		{
+			"[0:1][1:2]={{a;b};{c;d}}", ';',
+			[]ArrayDimension{{2, 0}, {2, 1}},
+			[]RawValue{{Value: []byte("a")}, {Value: []byte("b")}, {Value: []byte("c")}, {Value: []byte("d")}},
+		},
+	}
+	for _, test := range cases {
+		a, err := ParseArray(FormatText, []byte(test.input), test.delim)
+		if err != nil {
+			t.Fatalf("%q: %v", test.input, err)
+		}
+		if !reflect.DeepEqual(a.Dimensions, test.dimensions) || len(a.Elements) != len(test.elements) {
+			t.Fatalf("%q: got %+v", test.input, a)
+		}
+		for i, element := range a.Elements {
+			expected := test.elements[i]
+			if element.IsNull != expected.IsNull || string(element.Value) != string(expected.Value) {
+				t.Fatalf("%q: element %d: got %+v", test.input, i, element)
+			}
+		}
+
+		encoded, err := a.AppendText(nil, test.delim)
+		if err != nil {
+			t.Fatal(err)
+		}
+		roundTrip, err := ParseArray(FormatText, encoded, test.delim)
+		if err != nil || !reflect.DeepEqual(roundTrip.Dimensions, a.Dimensions) {
+			t.Fatalf("%q: round trip failed with %q", test.input, encoded)
+		}
+	}
+
+	for _, invalid := range []string{"", "{", "{1,}", "{{1},2}", "{{1},{2,3}}", "[1:2]={1}"} {
+		if _, err := ParseArray(FormatText, []byte(invalid), ','); err == nil {
+			t.Fatalf("%q: expected error", invalid)
+		}
+	}
+}
+
+func TestArrayBinaryRoundTrip(t *testing.T) {
+	a := Array{
+		Dimensions: []ArrayDimension{{2, 1}},
+		ElementOid: 20,
+		Elements:   []RawValue{{Value: []byte("\x00\x00\x00\x00\x00\x00\x00\x07")}, {IsNull: true}},
+	}
+	encoded, err := a.AppendBinary(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ParseArray(FormatBinary, encoded, ',')
+	if err != nil || !reflect.DeepEqual(got, a) {
+		t.Fatalf("got %+v (%v)", got, err)
+	}
+}
+
+func TestDecodeArray(t *testing.T) {
+	encoded := AppendArray(nil, []int64{1, -2, 3}, ',', AppendInt64)
+	got, err := DecodeArray(FormatText, encoded, ',', DecodeInt64)
+	if err != nil || !reflect.DeepEqual(got, []int64{1, -2, 3}) {
+		t.Fatalf("got %v (%v)", got, err)
+	}
+	if _, err := DecodeArray(FormatText, []byte("{1,NULL}"), ',', DecodeInt64); err == nil {
+		t.FailNow()
+	}
+}
@@ -92,6 +92,13 @@ func (b *builder) appendRawString(s string) {
 	b.b = append(b.b, s...)
 }
 
+func (b *builder) appendRawBytes(p []byte) {
+	if b.firstError != nil {
+		return
+	}
+	b.b = append(b.b, p...)
+}
+
 func (b *builder) finalizeMessage() error {
 	if b.firstError != nil {
 		return b.firstError
@@ -182,6 +189,38 @@ func (b *builder) describeStatement(preparedStatement string) error {
 	return b.finalizeMessage()
 }
 
+func (b *builder) bind(portal, preparedStatement string, parameters []RawValue) error {
+	b.newMessage('B')
+	b.appendString(portal)
+	b.appendString(preparedStatement)
+	b.appendInt16(0) // all parameters use the text format
+	b.appendInt16(len(parameters))
+	for _, p := range parameters {
+		if p.IsNull {
+			b.appendInt32(-1)
+			continue
+		}
+		b.appendInt32(len(p.Value))
+		b.appendRawBytes(p.Value)
+	}
+	b.appendInt16(0) // all results use the text format
+	return b.finalizeMessage()
+}
+
+func (b *builder) describePortal(portal string) error {
+	b.newMessage('D')
+	b.b = append(b.b, 'P')
+	b.appendString(portal)
+	return b.finalizeMessage()
+}
+
+func (b *builder) execute(portal string) error {
+	b.newMessage('E')
+	b.appendString(portal)
+	b.appendInt32(0) // no row limit
+	return b.finalizeMessage()
+}
+
 func (b *builder) sync() {
 	b.newMessage('S')
 	if err := b.finalizeMessage(); err != nil {
@@ -7,7 +7,6 @@ import (
 	"strings"
 	"time"
 
-	"github.com/erikfastermann/sql/util"
 	"github.com/xdg-go/scram"
 )
 
@@ -349,15 +348,19 @@ func (c *Conn) RunQuery(query string) error {
 
 var errBlankQueryString = errors.New("blank query string")
 
+func (c *Conn) resetQueryState() {
+	c.rowIterationDone = false
+	c.lastRowError = nil
+	c.LastCommand = CommandUnknown
+	c.LastRowCount = 0
+}
+
 func (c *Conn) queryBase(query string) error {
 	if err := c.sync(); err != nil {
 		return err
 	}
 
-	c.rowIterationDone = false
-	c.lastRowError = nil
-	c.LastCommand = CommandUnknown
-	c.LastRowCount = 0
+	c.resetQueryState()
 
 	if strings.TrimSpace(query) == "" {
 		// TODO: probably does not work if the line is only a comment
@@ -375,89 +378,125 @@ func (c *Conn) queryBase(query string) error {
 	return nil
 }
 
-func (c *Conn) NextRow() bool {
-	if c.fatalError != nil || c.rowIterationDone || c.lastRowError != nil {
-		return false
+// ExecuteParams uses the extended query protocol,
+// parameters are sent in the text format.
+func (c *Conn) ExecuteParams(query string, parameters []RawValue) error {
+	if err := c.extendedQueryBase(query, parameters, false); err != nil {
+		return err
+	}
+	for {
+		if err := c.r.readMessage(); err != nil {
+			return err
+		}
+		kind, err := c.r.peekKind()
+		if err != nil {
+			return err
+		}
+		switch kind {
+		case 'D':
+			// rows are discarded
+			continue
+		case 'I':
+			if err := c.r.emptyQueryResponse(); err != nil {
+				return err
+			}
+		default:
+			if err := c.r.commandComplete(); err != nil {
+				return err
+			}
+		}
+		return c.sync()
 	}
+}
 
+// RunQueryParams uses the extended query protocol,
+// parameters are sent in the text format and results are received in the text format.
+// Iterate the rows with NextRow and finish with CloseQuery.
+func (c *Conn) RunQueryParams(query string, parameters []RawValue) error {
+	if err := c.extendedQueryBase(query, parameters, true); err != nil {
+		return err
+	}
 	if err := c.r.readMessage(); err != nil {
-		c.lastRowError = err
-		return false
+		return err
 	}
 	kind, err := c.r.peekKind()
 	if err != nil {
-		c.lastRowError = err
-		return false
-	}
-	if kind == 'C' {
-		c.rowIterationDone = true
-		return false
+		return err
 	}
-	if err := c.r.dataRow(); err != nil {
-		c.lastRowError = err
-		return false
+	if kind == 'n' {
+		if err := c.r.noData(); err != nil {
+			return err
+		}
+		c.CurrentFields = c.CurrentFields[:0]
+		c.currentDataFields = c.currentDataFields[:0]
+		return nil
 	}
-	return true
+	return c.r.rowDescription()
 }
 
-var (
-	errInvalidResultRowIndex = errors.New("invalid result row index")
-	errInvalidColumnType     = errors.New("invalid column type")
-	ErrNullValue             = errors.New("null value")
-)
+func (c *Conn) extendedQueryBase(query string, parameters []RawValue, describe bool) error {
+	if err := c.sync(); err != nil {
+		return err
+	}
 
-func (c *Conn) FieldsLength() int {
-	return len(c.CurrentFields)
-}
+	c.resetQueryState()
 
-func (c *Conn) FieldIsNull(index int) bool {
-	if index < 0 || index >= len(c.currentDataFields) {
-		panic(errInvalidResultRowIndex)
+	c.b.reset()
+	if err := c.b.parse("", []byte(query)); err != nil {
+		return err
 	}
-	return c.currentDataFields[index].isNull
-}
-
-func (c *Conn) FieldBorrowRawBytes(index int) []byte {
-	if index < 0 || index >= len(c.CurrentFields) {
-		panic(errInvalidResultRowIndex)
+	if err := c.b.bind("", "", parameters); err != nil {
+		return err
 	}
-	if c.currentDataFields[index].isNull {
-		panic(ErrNullValue)
+	if describe {
+		if err := c.b.describePortal(""); err != nil {
+			return err
+		}
 	}
-	return c.currentDataFields[index].value
-}
+	if err := c.b.execute(""); err != nil {
+		return err
+	}
+	c.b.sync()
+	if err := c.writeMessage(); err != nil {
+		return err
+	}
+	c.needSync = true
 
-func (c *Conn) FieldInt(index int) (int, error) {
-	if index < 0 || index >= len(c.CurrentFields) {
-		panic(errInvalidResultRowIndex)
+	if err := c.r.readMessage(); err != nil {
+		return err
 	}
-	if c.currentDataFields[index].isNull {
-		panic(ErrNullValue)
+	if err := c.r.parseComplete(); err != nil {
+		return err
 	}
-	i64, err := util.ParseInt64(c.currentDataFields[index].value)
-	if err != nil {
-		return -1, err
+	if err := c.r.readMessage(); err != nil {
+		return err
 	}
-	return util.SafeConvert[int64, int](i64)
+	return c.r.bindComplete()
 }
 
-func (c *Conn) FieldBool(index int) (bool, error) {
-	if index < 0 || index >= len(c.CurrentFields) {
-		panic(errInvalidResultRowIndex)
-	}
-	if c.currentDataFields[index].isNull {
-		panic(ErrNullValue)
+func (c *Conn) NextRow() bool {
+	if c.fatalError != nil || c.rowIterationDone || c.lastRowError != nil {
+		return false
 	}
 
-	value := c.currentDataFields[index].value
-	switch string(value) { // does not allocate
-	case "f":
-		return false, nil
-	case "t":
-		return true, nil
-	default:
-		return false, errInvalidColumnType
+	if err := c.r.readMessage(); err != nil {
+		c.lastRowError = err
+		return false
+	}
+	kind, err := c.r.peekKind()
+	if err != nil {
+		c.lastRowError = err
+		return false
+	}
+	if kind == 'C' {
+		c.rowIterationDone = true
+		return false
+	}
+	if err := c.r.dataRow(); err != nil {
+		c.lastRowError = err
+		return false
 	}
+	return true
 }
 
 func (c *Conn) CloseQuery() error {
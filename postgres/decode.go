@@ -0,0 +1,700 @@
+package postgres
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/erikfastermann/sql/util"
+)
+
+// Format codes as used by the protocol.
+const (
+	FormatText   = 0
+	FormatBinary = 1
+)
+
+var (
+	errUnknownFormat    = errors.New("unknown format code")
+	errInvalidLength    = errors.New("invalid binary value length")
+	errInfiniteTime     = errors.New("infinite date or timestamp can not be represented")
+	errInvalidTime      = errors.New("invalid date or time")
+	errInvalidInterval  = errors.New("invalid interval")
+	errIntervalMonths   = errors.New("interval with months can not be represented as a duration")
+	errInvalidNumeric   = errors.New("invalid numeric")
+	errNumericNotFinite = errors.New("numeric is not a finite number")
+	errInvalidUUID      = errors.New("invalid uuid")
+	errInvalidInet      = errors.New("invalid inet or cidr")
+	errInvalidJSONB     = errors.New("unsupported jsonb version")
+	errInvalidBytea     = errors.New("invalid bytea")
+)
+
+// The decoders below convert a single non-null value in the text or binary
+// format into the matching Go value. The input is never referenced
+// by the result.
+
+func DecodeBool(format int, b []byte) (bool, error) {
+	switch format {
+	case FormatText:
+		switch string(b) { // does not allocate
+		case "f":
+			return false, nil
+		case "t":
+			return true, nil
+		default:
+			return false, errInvalidColumnType
+		}
+	case FormatBinary:
+		if len(b) != 1 {
+			return false, errInvalidLength
+		}
+		return b[0] != 0, nil
+	default:
+		return false, errUnknownFormat
+	}
+}
+
+// DecodeInt64 accepts the binary format of int2, int4 and int8.
+func DecodeInt64(format int, b []byte) (int64, error) {
+	switch format {
+	case FormatText:
+		return util.ParseInt64(b)
+	case FormatBinary:
+		switch len(b) {
+		case 2:
+			return int64(int16(binary.BigEndian.Uint16(b))), nil
+		case 4:
+			return int64(int32(binary.BigEndian.Uint32(b))), nil
+		case 8:
+			return int64(binary.BigEndian.Uint64(b)), nil
+		default:
+			return 0, errInvalidLength
+		}
+	default:
+		return 0, errUnknownFormat
+	}
+}
+
+func DecodeInt32(format int, b []byte) (int32, error) {
+	return decodeIntConvert[int32](format, b)
+}
+
+func DecodeInt16(format int, b []byte) (int16, error) {
+	return decodeIntConvert[int16](format, b)
+}
+
+func DecodeInt(format int, b []byte) (int, error) {
+	return decodeIntConvert[int](format, b)
+}
+
+func decodeIntConvert[T util.Integer](format int, b []byte) (T, error) {
+	i64, err := DecodeInt64(format, b)
+	if err != nil {
+		return 0, err
+	}
+	return util.SafeConvert[int64, T](i64)
+}
+
+// DecodeFloat64 accepts the binary format of float4 and float8.
+func DecodeFloat64(format int, b []byte) (float64, error) {
+	switch format {
+	case FormatText:
+		// ParseFloat understands NaN, Infinity and -Infinity
+		return strconv.ParseFloat(string(b), 64)
+	case FormatBinary:
+		switch len(b) {
+		case 4:
+			return float64(math.Float32frombits(binary.BigEndian.Uint32(b))), nil
+		case 8:
+			return math.Float64frombits(binary.BigEndian.Uint64(b)), nil
+		default:
+			return 0, errInvalidLength
+		}
+	default:
+		return 0, errUnknownFormat
+	}
+}
+
+func DecodeFloat32(format int, b []byte) (float32, error) {
+	switch format {
+	case FormatText:
+		f, err := strconv.ParseFloat(string(b), 32)
+		return float32(f), err
+	case FormatBinary:
+		if len(b) != 4 {
+			return 0, errInvalidLength
+		}
+		return math.Float32frombits(binary.BigEndian.Uint32(b)), nil
+	default:
+		return 0, errUnknownFormat
+	}
+}
+
+// DecodeString works with every type in the text format
+// and with text like types (text, varchar, bpchar, name, ...) in the binary format.
+func DecodeString(format int, b []byte) (string, error) {
+	if format != FormatText && format != FormatBinary {
+		return "", errUnknownFormat
+	}
+	return string(b), nil
+}
+
+func DecodeBytea(format int, b []byte) ([]byte, error) {
+	switch format {
+	case FormatText:
+		if bytes.HasPrefix(b, []byte(`\x`)) {
+			out := make([]byte, hex.DecodedLen(len(b)-2))
+			if _, err := hex.Decode(out, b[2:]); err != nil {
+				return nil, errInvalidBytea
+			}
+			return out, nil
+		}
+		return decodeByteaEscape(b)
+	case FormatBinary:
+		return append([]byte{}, b...), nil
+	default:
+		return nil, errUnknownFormat
+	}
+}
+
+// decodeByteaEscape handles the historical escape output format.
+func decodeByteaEscape(b []byte) ([]byte, error) {
+	out := make([]byte, 0, len(b))
+	for i := 0; i < len(b); i++ {
+		if b[i] != '\\' {
+			out = append(out, b[i])
+			continue
+		}
+		if i+1 < len(b) && b[i+1] == '\\' {
+			out = append(out, '\\')
+			i++
+			continue
+		}
+		if i+3 >= len(b) {
+			return nil, errInvalidBytea
+		}
+		n, err := strconv.ParseUint(string(b[i+1:i+4]), 8, 8)
+		if err != nil {
+			return nil, errInvalidBytea
+		}
+		out = append(out, byte(n))
+		i += 3
+	}
+	return out, nil
+}
+
+// postgresEpoch is the reference point of the binary date and time formats.
+var postgresEpoch = time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// DecodeDate returns midnight UTC of the date.
+func DecodeDate(format int, b []byte) (time.Time, error) {
+	switch format {
+	case FormatText:
+		s, bc := trimBC(string(b))
+		if s == "infinity" || s == "-infinity" {
+			return time.Time{}, errInfiniteTime
+		}
+		year, month, day, ok := parseDate(s)
+		if !ok {
+			return time.Time{}, errInvalidTime
+		}
+		if bc {
+			year = 1 - year
+		}
+		return time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC), nil
+	case FormatBinary:
+		if len(b) != 4 {
+			return time.Time{}, errInvalidLength
+		}
+		days := int32(binary.BigEndian.Uint32(b))
+		if days == math.MaxInt32 || days == math.MinInt32 {
+			return time.Time{}, errInfiniteTime
+		}
+		return postgresEpoch.AddDate(0, 0, int(days)), nil
+	default:
+		return time.Time{}, errUnknownFormat
+	}
+}
+
+// DecodeTimestamp handles timestamp and timestamptz.
+// Values without a time zone are returned in UTC.
+func DecodeTimestamp(format int, b []byte) (time.Time, error) {
+	switch format {
+	case FormatText:
+		s, bc := trimBC(string(b))
+		if s == "infinity" || s == "-infinity" {
+			return time.Time{}, errInfiniteTime
+		}
+		datePart, timePart, ok := strings.Cut(s, " ")
+		if !ok {
+			return time.Time{}, errInvalidTime
+		}
+		year, month, day, ok := parseDate(datePart)
+		if !ok {
+			return time.Time{}, errInvalidTime
+		}
+		if bc {
+			year = 1 - year
+		}
+		clock, loc, ok := parseClock(timePart)
+		if !ok {
+			return time.Time{}, errInvalidTime
+		}
+		return time.Date(year, time.Month(month), day, 0, 0, 0, 0, loc).Add(clock), nil
+	case FormatBinary:
+		if len(b) != 8 {
+			return time.Time{}, errInvalidLength
+		}
+		micros := int64(binary.BigEndian.Uint64(b))
+		if micros == math.MaxInt64 || micros == math.MinInt64 {
+			return time.Time{}, errInfiniteTime
+		}
+		return timeFromMicros(micros), nil
+	default:
+		return time.Time{}, errUnknownFormat
+	}
+}
+
+// DecodeTimeOfDay handles time and timetz.
+// The result is on January 1 of year 0, in UTC if no offset is known.
+func DecodeTimeOfDay(format int, b []byte) (time.Time, error) {
+	switch format {
+	case FormatText:
+		clock, loc, ok := parseClock(string(b))
+		if !ok {
+			return time.Time{}, errInvalidTime
+		}
+		return time.Date(0, time.January, 1, 0, 0, 0, 0, loc).Add(clock), nil
+	case FormatBinary:
+		loc := time.UTC
+		switch len(b) {
+		case 8:
+		case 12:
+			// seconds west of UTC
+			offset := -int(int32(binary.BigEndian.Uint32(b[8:])))
+			loc = time.FixedZone("", offset)
+		default:
+			return time.Time{}, errInvalidLength
+		}
+		micros := int64(binary.BigEndian.Uint64(b))
+		clock := microsToDuration(micros)
+		return time.Date(0, time.January, 1, 0, 0, 0, 0, loc).Add(clock), nil
+	default:
+		return time.Time{}, errUnknownFormat
+	}
+}
+
+// timeFromMicros avoids time.Duration, which can only span about 292 years.
+func timeFromMicros(micros int64) time.Time {
+	seconds, remainder := micros/1e6, micros%1e6
+	return time.Unix(postgresEpoch.Unix()+seconds, remainder*1e3).UTC()
+}
+
+func microsToDuration(micros int64) time.Duration {
+	return time.Duration(micros) * time.Microsecond
+}
+
+func trimBC(s string) (string, bool) {
+	if strings.HasSuffix(s, " BC") {
+		return s[:len(s)-len(" BC")], true
+	}
+	return s, false
+}
+
+// parseDate parses the ISO date style (YYYY-MM-DD, the year might be longer).
+func parseDate(s string) (year, month, day int, ok bool) {
+	yearRaw, rest, ok := strings.Cut(s, "-")
+	if !ok {
+		return 0, 0, 0, false
+	}
+	monthRaw, dayRaw, ok := strings.Cut(rest, "-")
+	if !ok {
+		return 0, 0, 0, false
+	}
+	year, ok1 := parseDigits(yearRaw)
+	month, ok2 := parseDigits(monthRaw)
+	day, ok3 := parseDigits(dayRaw)
+	if !ok1 || !ok2 || !ok3 || len(yearRaw) < 4 || len(monthRaw) != 2 || len(dayRaw) != 2 {
+		return 0, 0, 0, false
+	}
+	return year, month, day, true
+}
+
+// parseClock parses hh:mm:ss[.ffffff][(+|-)hh[:mm[:ss]]].
+func parseClock(s string) (time.Duration, *time.Location, bool) {
+	loc := time.UTC
+	if i := strings.IndexAny(s, "+-"); i >= 0 {
+		offset, ok := parseOffset(s[i+1:])
+		if !ok {
+			return 0, nil, false
+		}
+		if s[i] == '-' {
+			offset = -offset
+		}
+		loc = time.FixedZone("", offset)
+		s = s[:i]
+	}
+
+	s, fraction, hasFraction := strings.Cut(s, ".")
+	parts := strings.Split(s, ":")
+	if len(parts) != 3 {
+		return 0, nil, false
+	}
+	var hms [3]int
+	for i, part := range parts {
+		n, ok := parseDigits(part)
+		if !ok || len(part) != 2 {
+			return 0, nil, false
+		}
+		hms[i] = n
+	}
+	d := time.Duration(hms[0])*time.Hour +
+		time.Duration(hms[1])*time.Minute +
+		time.Duration(hms[2])*time.Second
+	if hasFraction {
+		if len(fraction) == 0 || len(fraction) > 9 {
+			return 0, nil, false
+		}
+		n, ok := parseDigits(fraction)
+		if !ok {
+			return 0, nil, false
+		}
+		for i := len(fraction); i < 9; i++ {
+			n *= 10
+		}
+		d += time.Duration(n)
+	}
+	return d, loc, true
+}
+
+// parseOffset parses hh[:mm[:ss]] and returns seconds.
+func parseOffset(s string) (int, bool) {
+	parts := strings.Split(s, ":")
+	if len(parts) > 3 {
+		return 0, false
+	}
+	offset := 0
+	multiplier := 60 * 60
+	for _, part := range parts {
+		n, ok := parseDigits(part)
+		if !ok || len(part) != 2 {
+			return 0, false
+		}
+		offset += n * multiplier
+		multiplier /= 60
+	}
+	return offset, true
+}
+
+func parseDigits(s string) (int, bool) {
+	if len(s) == 0 || len(s) > 9 {
+		return 0, false
+	}
+	n := 0
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return 0, false
+		}
+		n = n*10 + int(s[i]-'0')
+	}
+	return n, true
+}
+
+// Interval mirrors the fields stored by Postgres,
+// because months and days do not have a fixed length.
+type Interval struct {
+	Microseconds int64
+	Days         int32
+	Months       int32
+}
+
+// Duration treats a day as 24 hours and fails if months are set.
+func (i Interval) Duration() (time.Duration, error) {
+	if i.Months != 0 {
+		return 0, errIntervalMonths
+	}
+	return time.Duration(i.Days)*24*time.Hour + microsToDuration(i.Microseconds), nil
+}
+
+// DecodeInterval supports the default postgres IntervalStyle in the text format.
+func DecodeInterval(format int, b []byte) (Interval, error) {
+	switch format {
+	case FormatText:
+		return parseInterval(string(b))
+	case FormatBinary:
+		if len(b) != 16 {
+			return Interval{}, errInvalidLength
+		}
+		return Interval{
+			Microseconds: int64(binary.BigEndian.Uint64(b)),
+			Days:         int32(binary.BigEndian.Uint32(b[8:])),
+			Months:       int32(binary.BigEndian.Uint32(b[12:])),
+		}, nil
+	default:
+		return Interval{}, errUnknownFormat
+	}
+}
+
+// parseInterval parses e.g. "1 year 2 mons -3 days +04:05:06.789".
+func parseInterval(s string) (Interval, error) {
+	var interval Interval
+	fields := strings.Fields(s)
+	for i := 0; i < len(fields); i++ {
+		f := fields[i]
+		if strings.Contains(f, ":") {
+			negative := strings.HasPrefix(f, "-")
+			clock, loc, ok := parseClock(strings.TrimLeft(f, "+-"))
+			if !ok || loc != time.UTC {
+				// hours can exceed two digits
+				clock, ok = parseLongClock(strings.TrimLeft(f, "+-"))
+				if !ok {
+					return Interval{}, errInvalidInterval
+				}
+			}
+			if negative {
+				clock = -clock
+			}
+			interval.Microseconds += int64(clock / time.Microsecond)
+			continue
+		}
+		if i+1 >= len(fields) {
+			return Interval{}, errInvalidInterval
+		}
+		n, err := strconv.ParseInt(f, 10, 32)
+		if err != nil {
+			return Interval{}, errInvalidInterval
+		}
+		i++
+		switch fields[i] {
+		case "year", "years":
+			n *= 12
+			fallthrough
+		case "mon", "mons":
+			interval.Months += int32(n)
+		case "day", "days":
+			interval.Days += int32(n)
+		default:
+			return Interval{}, errInvalidInterval
+		}
+	}
+	return interval, nil
+}
+
+func parseLongClock(s string) (time.Duration, bool) {
+	hoursRaw, rest, ok := strings.Cut(s, ":")
+	if !ok {
+		return 0, false
+	}
+	hours, ok := parseDigits(hoursRaw)
+	if !ok {
+		return 0, false
+	}
+	clock, loc, ok := parseClock("00:" + rest)
+	if !ok || loc != time.UTC {
+		return 0, false
+	}
+	return time.Duration(hours)*time.Hour + clock, true
+}
+
+// DecodeNumeric returns the decimal representation,
+// NaN, Infinity and -Infinity are returned as is.
+func DecodeNumeric(format int, b []byte) (string, error) {
+	switch format {
+	case FormatText:
+		return string(b), nil
+	case FormatBinary:
+		return decodeNumericBinary(b)
+	default:
+		return "", errUnknownFormat
+	}
+}
+
+func decodeNumericBinary(b []byte) (string, error) {
+	const (
+		signPositive    = 0x0000
+		signNegative    = 0x4000
+		signNaN         = 0xC000
+		signPositiveInf = 0xD000
+		signNegativeInf = 0xF000
+	)
+
+	if len(b) < 8 {
+		return "", errInvalidLength
+	}
+	ndigits := int(binary.BigEndian.Uint16(b))
+	weight := int(int16(binary.BigEndian.Uint16(b[2:])))
+	sign := binary.BigEndian.Uint16(b[4:])
+	dscale := int(binary.BigEndian.Uint16(b[6:]))
+	if len(b) != 8+2*ndigits {
+		return "", errInvalidLength
+	}
+	switch sign {
+	case signPositive, signNegative:
+	case signNaN:
+		return "NaN", nil
+	case signPositiveInf:
+		return "Infinity", nil
+	case signNegativeInf:
+		return "-Infinity", nil
+	default:
+		return "", errInvalidNumeric
+	}
+
+	digit := func(i int) int {
+		if i < 0 || i >= ndigits {
+			return 0
+		}
+		return int(binary.BigEndian.Uint16(b[8+2*i:]))
+	}
+
+	var sb strings.Builder
+	if sign == signNegative {
+		sb.WriteByte('-')
+	}
+	// each digit represents four decimal digits
+	if weight < 0 {
+		sb.WriteByte('0')
+	} else {
+		for i := 0; i <= weight; i++ {
+			d := digit(i)
+			if i == 0 {
+				sb.WriteString(strconv.Itoa(d))
+			} else {
+				fmt.Fprintf(&sb, "%04d", d)
+			}
+		}
+	}
+	if dscale > 0 {
+		sb.WriteByte('.')
+		var fraction strings.Builder
+		for i := weight + 1; fraction.Len() < dscale; i++ {
+			fmt.Fprintf(&fraction, "%04d", digit(i))
+		}
+		sb.WriteString(fraction.String()[:dscale])
+	}
+	return sb.String(), nil
+}
+
+// DecodeBigRat fails for NaN and infinite values.
+func DecodeBigRat(format int, b []byte) (*big.Rat, error) {
+	s, err := DecodeNumeric(format, b)
+	if err != nil {
+		return nil, err
+	}
+	switch s {
+	case "NaN", "Infinity", "-Infinity":
+		return nil, errNumericNotFinite
+	}
+	r, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return nil, errInvalidNumeric
+	}
+	return r, nil
+}
+
+func DecodeUUID(format int, b []byte) ([16]byte, error) {
+	var uuid [16]byte
+	switch format {
+	case FormatText:
+		s := strings.ReplaceAll(strings.Trim(string(b), "{}"), "-", "")
+		if len(s) != 32 {
+			return uuid, errInvalidUUID
+		}
+		if _, err := hex.Decode(uuid[:], []byte(s)); err != nil {
+			return uuid, errInvalidUUID
+		}
+		return uuid, nil
+	case FormatBinary:
+		if len(b) != 16 {
+			return uuid, errInvalidLength
+		}
+		copy(uuid[:], b)
+		return uuid, nil
+	default:
+		return uuid, errUnknownFormat
+	}
+}
+
+// DecodePrefix handles inet and cidr.
+// An inet without a netmask is returned as a single address prefix.
+func DecodePrefix(format int, b []byte) (netip.Prefix, error) {
+	switch format {
+	case FormatText:
+		s := string(b)
+		if !strings.Contains(s, "/") {
+			addr, err := netip.ParseAddr(s)
+			if err != nil {
+				return netip.Prefix{}, err
+			}
+			return netip.PrefixFrom(addr, addr.BitLen()), nil
+		}
+		return netip.ParsePrefix(s)
+	case FormatBinary:
+		const (
+			familyInet4 = 2
+			familyInet6 = 3
+		)
+		if len(b) < 4 {
+			return netip.Prefix{}, errInvalidLength
+		}
+		family, bits, length := b[0], int(b[1]), int(b[3])
+		addrRaw := b[4:]
+		if len(addrRaw) != length {
+			return netip.Prefix{}, errInvalidLength
+		}
+		var addr netip.Addr
+		switch {
+		case family == familyInet4 && length == 4:
+			var a [4]byte
+			copy(a[:], addrRaw)
+			addr = netip.AddrFrom4(a)
+		case family == familyInet6 && length == 16:
+			var a [16]byte
+			copy(a[:], addrRaw)
+			addr = netip.AddrFrom16(a)
+		default:
+			return netip.Prefix{}, errInvalidInet
+		}
+		prefix := netip.PrefixFrom(addr, bits)
+		if !prefix.IsValid() {
+			return netip.Prefix{}, errInvalidInet
+		}
+		return prefix, nil
+	default:
+		return netip.Prefix{}, errUnknownFormat
+	}
+}
+
+// DecodeJSON handles json and jsonb and returns a copy of the document.
+func DecodeJSON(format int, b []byte) (json.RawMessage, error) {
+	switch format {
+	case FormatText:
+		return append(json.RawMessage{}, b...), nil
+	case FormatBinary:
+		// json is sent as is, jsonb is prefixed with a version number
+		if len(b) > 0 && b[0] == 1 {
+			return append(json.RawMessage{}, b[1:]...), nil
+		}
+		if len(b) > 0 && b[0] < ' ' && !isJSONSpace(b[0]) {
+			return nil, errInvalidJSONB
+		}
+		return append(json.RawMessage{}, b...), nil
+	default:
+		return nil, errUnknownFormat
+	}
+}
+
+// isJSONSpace reports whether c is whitespace in json,
+// a binary json value can start with it, unlike a jsonb version.
+func isJSONSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
@@ -0,0 +1,113 @@
+package postgres
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+)
+
+func TestDecodeTime(t *testing.T) {
+	cases := []struct {
+		decode   func(int, []byte) (time.Time, error)
+		format   int
+		input    string
+		expected time.Time
+	}{
+		{DecodeDate, FormatText, "2023-01-02", time.Date(2023, 1, 2, 0, 0, 0, 0, time.UTC)},
+		{DecodeDate, FormatText, "0044-03-15 BC", time.Date(-43, 3, 15, 0, 0, 0, 0, time.UTC)},
+		{DecodeDate, FormatBinary, "\x00\x00\x00\x01", time.Date(2000, 1, 2, 0, 0, 0, 0, time.UTC)},
+		{
+			DecodeTimestamp, FormatText, "2023-01-02 15:04:05.5",
+			time.Date(2023, 1, 2, 15, 4, 5, 500_000_000, time.UTC),
+		},
+		{
+			DecodeTimestamp, FormatText, "2023-01-02 15:04:05+05:30",
+			time.Date(2023, 1, 2, 9, 34, 5, 0, time.UTC),
+		},
+		{
+			DecodeTimestamp, FormatBinary, "\xff\xff\xff\xff\xff\xff\xff\xff",
+			time.Date(1999, 12, 31, 23, 59, 59, 999_999_000, time.UTC),
+		},
+		{
+			DecodeTimeOfDay, FormatText, "13:14:15.000001",
+			time.Date(0, 1, 1, 13, 14, 15, 1000, time.UTC),
+		},
+	}
+	for _, test := range cases {
+		got, err := test.decode(test.format, []byte(test.input))
+		if err != nil || !got.Equal(test.expected) {
+			t.Fatalf("%q: got %v (%v), expected %v", test.input, got, err, test.expected)
+		}
+	}
+}
+
+func TestDecodeInterval(t *testing.T) {
+	cases := []struct {
+		input    string
+		expected Interval
+	}{
+		{"00:00:00", Interval{}},
+		{"1 year 2 mons -3 days +04:05:06.5", Interval{14_706_500_000, -3, 14}},
+		{"-100:00:01", Interval{-360_001_000_000, 0, 0}},
+	}
+	for _, test := range cases {
+		got, err := DecodeInterval(FormatText, []byte(test.input))
+		if err != nil || got != test.expected {
+			t.Fatalf("%q: got %+v (%v), expected %+v", test.input, got, err, test.expected)
+		}
+	}
+}
+
+func TestDecodeNumericBinary(t *testing.T) {
+	cases := []struct {
+		input    string
+		expected string
+	}{
+		{"\x00\x00\x00\x00\x00\x00\x00\x00", "0"},
+		{"\x00\x02\x00\x01\x00\x00\x00\x00\x00\x01\x09\x29", "12345"},
+		{"\x00\x02\x00\x00\x40\x00\x00\x02\x00\x0c\x0d\x48", "-12.34"},
+		{"\x00\x01\xff\xfe\x00\x00\x00\x08\x00\x0c", "0.00000012"},
+		{"\x00\x00\x00\x00\xc0\x00\x00\x00", "NaN"},
+	}
+	for _, test := range cases {
+		got, err := DecodeNumeric(FormatBinary, []byte(test.input))
+		if err != nil || got != test.expected {
+			t.Fatalf("got %q (%v), expected %q", got, err, test.expected)
+		}
+	}
+}
+
+func TestDecodeMisc(t *testing.T) {
+	uuid, err := DecodeUUID(FormatText, []byte("a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a11"))
+	if err != nil || uuid[0] != 0xa0 || uuid[15] != 0x11 {
+		t.FailNow()
+	}
+
+	prefix, err := DecodePrefix(FormatText, []byte("10.0.0.1"))
+	if err != nil || prefix != netip.MustParsePrefix("10.0.0.1/32") {
+		t.FailNow()
+	}
+	prefix, err = DecodePrefix(FormatBinary, []byte("\x02\x08\x01\x04\x0a\x00\x00\x00"))
+	if err != nil || prefix != netip.MustParsePrefix("10.0.0.0/8") {
+		t.FailNow()
+	}
+
+	bytea, err := DecodeBytea(FormatText, []byte(`\x00ff`))
+	if err != nil || string(bytea) != "\x00\xff" {
+		t.FailNow()
+	}
+
+	raw, err := DecodeJSON(FormatBinary, []byte("\x01{}"))
+	if err != nil || string(raw) != "{}" {
+		t.FailNow()
+	}
+
+	raw, err = DecodeJSON(FormatBinary, []byte("\n\t{\"a\": 1}\n"))
+	if err != nil || string(raw) != "\n\t{\"a\": 1}\n" {
+		t.FailNow()
+	}
+
+	if _, err := DecodeJSON(FormatBinary, []byte("\x02{}")); err != errInvalidJSONB {
+		t.FailNow()
+	}
+}
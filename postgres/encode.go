@@ -0,0 +1,195 @@
+package postgres
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"math"
+	"math/big"
+	"net/netip"
+	"strconv"
+	"time"
+)
+
+// The encoders below append the text format of a value,
+// they are the counterpart of the decoders.
+
+func AppendBool(b []byte, v bool) []byte {
+	if v {
+		return append(b, 't')
+	}
+	return append(b, 'f')
+}
+
+func AppendInt(b []byte, v int) []byte {
+	return strconv.AppendInt(b, int64(v), 10)
+}
+
+func AppendInt16(b []byte, v int16) []byte {
+	return strconv.AppendInt(b, int64(v), 10)
+}
+
+func AppendInt32(b []byte, v int32) []byte {
+	return strconv.AppendInt(b, int64(v), 10)
+}
+
+func AppendInt64(b []byte, v int64) []byte {
+	return strconv.AppendInt(b, v, 10)
+}
+
+func AppendFloat32(b []byte, v float32) []byte {
+	return appendFloat(b, float64(v), 32)
+}
+
+func AppendFloat64(b []byte, v float64) []byte {
+	return appendFloat(b, v, 64)
+}
+
+func appendFloat(b []byte, v float64, bitSize int) []byte {
+	switch {
+	case math.IsNaN(v):
+		return append(b, "NaN"...)
+	case math.IsInf(v, 1):
+		return append(b, "Infinity"...)
+	case math.IsInf(v, -1):
+		return append(b, "-Infinity"...)
+	default:
+		return strconv.AppendFloat(b, v, 'g', -1, bitSize)
+	}
+}
+
+func AppendString(b []byte, v string) []byte {
+	return append(b, v...)
+}
+
+func AppendBytea(b []byte, v []byte) []byte {
+	b = append(b, `\x`...)
+	return appendHex(b, v)
+}
+
+// AppendDate ignores the time of day and the location.
+func AppendDate(b []byte, v time.Time) []byte {
+	year, bc := postgresYear(v.Year())
+	b = appendPadded(b, year, 4)
+	b = v.AppendFormat(b, "-01-02")
+	if bc {
+		b = append(b, " BC"...)
+	}
+	return b
+}
+
+// AppendTimestamp includes the offset, which is ignored for timestamp without time zone.
+func AppendTimestamp(b []byte, v time.Time) []byte {
+	year, bc := postgresYear(v.Year())
+	b = appendPadded(b, year, 4)
+	b = v.AppendFormat(b, "-01-02 15:04:05.999999-07:00")
+	if bc {
+		b = append(b, " BC"...)
+	}
+	return b
+}
+
+// AppendTimeOfDay includes the offset, which is ignored for time without time zone.
+func AppendTimeOfDay(b []byte, v time.Time) []byte {
+	return v.AppendFormat(b, "15:04:05.999999-07:00")
+}
+
+// postgresYear converts the astronomical year numbering of Go.
+func postgresYear(year int) (int, bool) {
+	if year <= 0 {
+		return 1 - year, true
+	}
+	return year, false
+}
+
+func appendPadded(b []byte, n, width int) []byte {
+	s := strconv.Itoa(n)
+	for i := len(s); i < width; i++ {
+		b = append(b, '0')
+	}
+	return append(b, s...)
+}
+
+func AppendInterval(b []byte, v Interval) []byte {
+	b = strconv.AppendInt(b, int64(v.Months), 10)
+	b = append(b, " mons "...)
+	b = strconv.AppendInt(b, int64(v.Days), 10)
+	b = append(b, " days "...)
+	micros := v.Microseconds
+	if micros < 0 {
+		b = append(b, '-')
+		micros = -micros
+	}
+	seconds, micros := micros/1e6, micros%1e6
+	b = strconv.AppendInt(b, seconds/3600, 10)
+	b = append(b, ':')
+	b = appendPadded(b, int(seconds/60%60), 2)
+	b = append(b, ':')
+	b = appendPadded(b, int(seconds%60), 2)
+	b = append(b, '.')
+	return appendPadded(b, int(micros), 6)
+}
+
+func AppendDuration(b []byte, v time.Duration) []byte {
+	return AppendInterval(b, Interval{Microseconds: int64(v / time.Microsecond)})
+}
+
+// AppendNumeric expects a valid decimal representation.
+func AppendNumeric(b []byte, v string) []byte {
+	return append(b, v...)
+}
+
+// AppendBigRat rounds to 32 fractional digits
+// if v is not representable as a finite decimal.
+func AppendBigRat(b []byte, v *big.Rat) []byte {
+	const maxDigits = 32
+	denominator := new(big.Int).Set(v.Denom())
+	digits := 0
+	for _, factor := range [...]int64{2, 5} {
+		f := big.NewInt(factor)
+		var remainder big.Int
+		n := 0
+		for {
+			var quotient big.Int
+			quotient.QuoRem(denominator, f, &remainder)
+			if remainder.Sign() != 0 {
+				break
+			}
+			denominator.Set(&quotient)
+			n++
+		}
+		if n > digits {
+			digits = n
+		}
+	}
+	if !denominator.IsInt64() || denominator.Int64() != 1 || digits > maxDigits {
+		digits = maxDigits
+	}
+	return append(b, v.FloatString(digits)...)
+}
+
+func AppendUUID(b []byte, v [16]byte) []byte {
+	b = appendHex(b, v[:4])
+	b = append(b, '-')
+	b = appendHex(b, v[4:6])
+	b = append(b, '-')
+	b = appendHex(b, v[6:8])
+	b = append(b, '-')
+	b = appendHex(b, v[8:10])
+	b = append(b, '-')
+	return appendHex(b, v[10:])
+}
+
+func AppendPrefix(b []byte, v netip.Prefix) []byte {
+	return v.AppendTo(b)
+}
+
+func AppendJSON(b []byte, v json.RawMessage) []byte {
+	return append(b, v...)
+}
+
+func appendHex(b []byte, v []byte) []byte {
+	start := len(b)
+	b = append(b, make([]byte, hex.EncodedLen(len(v)))...)
+	hex.Encode(b[start:], v)
+	return b
+}
@@ -58,7 +58,8 @@ func (e *ErrorAndNoticeFields) assignField(typ byte, value []byte) {
 			})
 			return
 		}
-		e.Position = position
+		*positionRef = position
+		return
 	}
 
 	copied := string(value)
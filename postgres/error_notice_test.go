@@ -0,0 +1,15 @@
+package postgres
+
+import (
+	"testing"
+)
+
+func TestAssignPosition(t *testing.T) {
+	var e ErrorAndNoticeFields
+	e.assignField('P', []byte("12"))
+	e.assignField('p', []byte("3"))
+	e.assignField('q', []byte("select 1"))
+	if e.Position != 12 || e.PositionInternal != 3 || e.QueryInternal != "select 1" {
+		t.Fatalf("got %+v", e)
+	}
+}
@@ -0,0 +1,241 @@
+package postgres
+
+import (
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/netip"
+	"time"
+)
+
+var (
+	errInvalidResultRowIndex = errors.New("invalid result row index")
+	errInvalidColumnType     = errors.New("invalid column type")
+	ErrNullValue             = errors.New("null value")
+)
+
+// The Field accessors panic with ErrNullValue if the value is NULL,
+// the FieldMaybe variants report NULL with ok == false instead.
+// Every accessor panics if the index is out of range.
+
+func (c *Conn) FieldsLength() int {
+	return len(c.CurrentFields)
+}
+
+func (c *Conn) FieldIsNull(index int) bool {
+	if index < 0 || index >= len(c.currentDataFields) {
+		panic(errInvalidResultRowIndex)
+	}
+	return c.currentDataFields[index].isNull
+}
+
+func (c *Conn) FieldBorrowRawBytes(index int) []byte {
+	if index < 0 || index >= len(c.CurrentFields) {
+		panic(errInvalidResultRowIndex)
+	}
+	if c.currentDataFields[index].isNull {
+		panic(ErrNullValue)
+	}
+	return c.currentDataFields[index].value
+}
+
+func fieldDecode[T any](c *Conn, index int, decode func(format int, b []byte) (T, error)) (T, error) {
+	value := c.FieldBorrowRawBytes(index)
+	return decode(c.CurrentFields[index].FormatCode, value)
+}
+
+func fieldDecodeMaybe[T any](
+	c *Conn,
+	index int,
+	decode func(format int, b []byte) (T, error),
+) (value T, ok bool, err error) {
+	if c.FieldIsNull(index) {
+		return value, false, nil
+	}
+	value, err = fieldDecode(c, index, decode)
+	return value, true, err
+}
+
+func (c *Conn) FieldInt(index int) (int, error) {
+	return fieldDecode(c, index, DecodeInt)
+}
+
+func (c *Conn) FieldMaybeInt(index int) (int, bool, error) {
+	return fieldDecodeMaybe(c, index, DecodeInt)
+}
+
+func (c *Conn) FieldInt16(index int) (int16, error) {
+	return fieldDecode(c, index, DecodeInt16)
+}
+
+func (c *Conn) FieldMaybeInt16(index int) (int16, bool, error) {
+	return fieldDecodeMaybe(c, index, DecodeInt16)
+}
+
+func (c *Conn) FieldInt32(index int) (int32, error) {
+	return fieldDecode(c, index, DecodeInt32)
+}
+
+func (c *Conn) FieldMaybeInt32(index int) (int32, bool, error) {
+	return fieldDecodeMaybe(c, index, DecodeInt32)
+}
+
+func (c *Conn) FieldInt64(index int) (int64, error) {
+	return fieldDecode(c, index, DecodeInt64)
+}
+
+func (c *Conn) FieldMaybeInt64(index int) (int64, bool, error) {
+	return fieldDecodeMaybe(c, index, DecodeInt64)
+}
+
+func (c *Conn) FieldFloat32(index int) (float32, error) {
+	return fieldDecode(c, index, DecodeFloat32)
+}
+
+func (c *Conn) FieldMaybeFloat32(index int) (float32, bool, error) {
+	return fieldDecodeMaybe(c, index, DecodeFloat32)
+}
+
+func (c *Conn) FieldFloat64(index int) (float64, error) {
+	return fieldDecode(c, index, DecodeFloat64)
+}
+
+func (c *Conn) FieldMaybeFloat64(index int) (float64, bool, error) {
+	return fieldDecodeMaybe(c, index, DecodeFloat64)
+}
+
+func (c *Conn) FieldBool(index int) (bool, error) {
+	return fieldDecode(c, index, DecodeBool)
+}
+
+func (c *Conn) FieldMaybeBool(index int) (bool, bool, error) {
+	return fieldDecodeMaybe(c, index, DecodeBool)
+}
+
+// FieldString copies the value.
+func (c *Conn) FieldString(index int) (string, error) {
+	return fieldDecode(c, index, DecodeString)
+}
+
+func (c *Conn) FieldMaybeString(index int) (string, bool, error) {
+	return fieldDecodeMaybe(c, index, DecodeString)
+}
+
+func (c *Conn) FieldBytea(index int) ([]byte, error) {
+	return fieldDecode(c, index, DecodeBytea)
+}
+
+func (c *Conn) FieldMaybeBytea(index int) ([]byte, bool, error) {
+	return fieldDecodeMaybe(c, index, DecodeBytea)
+}
+
+func (c *Conn) FieldDate(index int) (time.Time, error) {
+	return fieldDecode(c, index, DecodeDate)
+}
+
+func (c *Conn) FieldMaybeDate(index int) (time.Time, bool, error) {
+	return fieldDecodeMaybe(c, index, DecodeDate)
+}
+
+// FieldTimestamp handles timestamp and timestamptz.
+func (c *Conn) FieldTimestamp(index int) (time.Time, error) {
+	return fieldDecode(c, index, DecodeTimestamp)
+}
+
+func (c *Conn) FieldMaybeTimestamp(index int) (time.Time, bool, error) {
+	return fieldDecodeMaybe(c, index, DecodeTimestamp)
+}
+
+// FieldTimeOfDay handles time and timetz.
+func (c *Conn) FieldTimeOfDay(index int) (time.Time, error) {
+	return fieldDecode(c, index, DecodeTimeOfDay)
+}
+
+func (c *Conn) FieldMaybeTimeOfDay(index int) (time.Time, bool, error) {
+	return fieldDecodeMaybe(c, index, DecodeTimeOfDay)
+}
+
+func (c *Conn) FieldInterval(index int) (Interval, error) {
+	return fieldDecode(c, index, DecodeInterval)
+}
+
+func (c *Conn) FieldMaybeInterval(index int) (Interval, bool, error) {
+	return fieldDecodeMaybe(c, index, DecodeInterval)
+}
+
+func decodeDuration(format int, b []byte) (time.Duration, error) {
+	interval, err := DecodeInterval(format, b)
+	if err != nil {
+		return 0, err
+	}
+	return interval.Duration()
+}
+
+// FieldDuration fails if the interval contains months.
+func (c *Conn) FieldDuration(index int) (time.Duration, error) {
+	return fieldDecode(c, index, decodeDuration)
+}
+
+func (c *Conn) FieldMaybeDuration(index int) (time.Duration, bool, error) {
+	return fieldDecodeMaybe(c, index, decodeDuration)
+}
+
+// FieldNumeric returns the decimal representation.
+func (c *Conn) FieldNumeric(index int) (string, error) {
+	return fieldDecode(c, index, DecodeNumeric)
+}
+
+func (c *Conn) FieldMaybeNumeric(index int) (string, bool, error) {
+	return fieldDecodeMaybe(c, index, DecodeNumeric)
+}
+
+func (c *Conn) FieldBigRat(index int) (*big.Rat, error) {
+	return fieldDecode(c, index, DecodeBigRat)
+}
+
+func (c *Conn) FieldMaybeBigRat(index int) (*big.Rat, bool, error) {
+	return fieldDecodeMaybe(c, index, DecodeBigRat)
+}
+
+func (c *Conn) FieldUUID(index int) ([16]byte, error) {
+	return fieldDecode(c, index, DecodeUUID)
+}
+
+func (c *Conn) FieldMaybeUUID(index int) ([16]byte, bool, error) {
+	return fieldDecodeMaybe(c, index, DecodeUUID)
+}
+
+// FieldPrefix handles inet and cidr.
+func (c *Conn) FieldPrefix(index int) (netip.Prefix, error) {
+	return fieldDecode(c, index, DecodePrefix)
+}
+
+func (c *Conn) FieldMaybePrefix(index int) (netip.Prefix, bool, error) {
+	return fieldDecodeMaybe(c, index, DecodePrefix)
+}
+
+// FieldJSON handles json and jsonb and copies the value.
+func (c *Conn) FieldJSON(index int) (json.RawMessage, error) {
+	return fieldDecode(c, index, DecodeJSON)
+}
+
+func (c *Conn) FieldMaybeJSON(index int) (json.RawMessage, bool, error) {
+	return fieldDecodeMaybe(c, index, DecodeJSON)
+}
+
+// FieldUnmarshalJSON handles json and jsonb.
+func (c *Conn) FieldUnmarshalJSON(index int, v any) error {
+	raw, err := c.FieldJSON(index)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(raw, v)
+}
+
+// FieldMaybeUnmarshalJSON leaves v untouched if the value is NULL.
+func (c *Conn) FieldMaybeUnmarshalJSON(index int, v any) (bool, error) {
+	if c.FieldIsNull(index) {
+		return false, nil
+	}
+	return true, c.FieldUnmarshalJSON(index, v)
+}
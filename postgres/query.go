@@ -0,0 +1,175 @@
+package postgres
+
+import (
+	"errors"
+	"fmt"
+)
+
+// The helpers in this file are used by the generated code.
+
+var (
+	ErrNoRows      = errors.New("query returned no rows")
+	ErrTooManyRows = errors.New("query returned more than one row")
+
+	ErrInvalidEnumLabel = errors.New("invalid enum label")
+)
+
+// ScanField is like the Field methods, but reports NULL as an error.
+func ScanField[T any](c *Conn, index int, decode func(format int, b []byte) (T, error)) (T, error) {
+	if c.FieldIsNull(index) {
+		var zero T
+		return zero, fmt.Errorf("field %s: %w", c.CurrentFields[index].Name, ErrNullValue)
+	}
+	v, err := fieldDecode(c, index, decode)
+	if err != nil {
+		return v, fmt.Errorf("field %s: %w", c.CurrentFields[index].Name, err)
+	}
+	return v, nil
+}
+
+// ScanMaybeField is like the FieldMaybe methods.
+func ScanMaybeField[T any](
+	c *Conn,
+	index int,
+	decode func(format int, b []byte) (T, error),
+) (T, bool, error) {
+	v, ok, err := fieldDecodeMaybe(c, index, decode)
+	if err != nil {
+		return v, ok, fmt.Errorf("field %s: %w", c.CurrentFields[index].Name, err)
+	}
+	return v, ok, nil
+}
+
+// QueryOne expects exactly one row.
+func QueryOne[T any](
+	c *Conn,
+	query string,
+	parameters []RawValue,
+	scan func(c *Conn) (T, error),
+) (T, error) {
+	v, ok, err := QueryOption(c, query, parameters, scan)
+	if err == nil && !ok {
+		err = ErrNoRows
+	}
+	return v, err
+}
+
+// QueryOption expects zero or one row.
+func QueryOption[T any](
+	c *Conn,
+	query string,
+	parameters []RawValue,
+	scan func(c *Conn) (T, error),
+) (v T, ok bool, err error) {
+	var zero T
+	if err := c.RunQueryParams(query, parameters); err != nil {
+		return zero, false, err
+	}
+	if c.NextRow() {
+		v, err = scan(c)
+		if err != nil {
+			return zero, false, closeQueryAfter(c, err)
+		}
+		ok = true
+		if c.NextRow() {
+			return zero, false, closeQueryAfter(c, ErrTooManyRows)
+		}
+	}
+	if err := c.CloseQuery(); err != nil {
+		return zero, false, err
+	}
+	return v, ok, nil
+}
+
+func QueryMany[T any](
+	c *Conn,
+	query string,
+	parameters []RawValue,
+	scan func(c *Conn) (T, error),
+) ([]T, error) {
+	if err := c.RunQueryParams(query, parameters); err != nil {
+		return nil, err
+	}
+	var out []T
+	for c.NextRow() {
+		v, err := scan(c)
+		if err != nil {
+			return nil, closeQueryAfter(c, err)
+		}
+		out = append(out, v)
+	}
+	if err := c.CloseQuery(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// closeQueryAfter consumes the remaining rows,
+// so the connection can be used again.
+func closeQueryAfter(c *Conn, err error) error {
+	if closeErr := c.CloseQuery(); closeErr != nil {
+		return fmt.Errorf("%w (close query: %v)", err, closeErr)
+	}
+	return err
+}
+
+// DecodeEnum decodes a label of the enum type name, valid reports known labels.
+func DecodeEnum[T ~string](format int, b []byte, name string, valid func(T) bool) (T, error) {
+	s, err := DecodeString(format, b)
+	if err != nil {
+		return "", err
+	}
+	if v := T(s); valid(v) {
+		return v, nil
+	}
+	return "", fmt.Errorf("%w %q of %s", ErrInvalidEnumLabel, s, name)
+}
+
+// ArrayDecoder returns a decoder for one dimensional arrays.
+func ArrayDecoder[T any](
+	delim byte,
+	decode func(format int, b []byte) (T, error),
+) func(format int, b []byte) ([]T, error) {
+	return func(format int, b []byte) ([]T, error) {
+		return DecodeArray(format, b, delim, decode)
+	}
+}
+
+// ArrayEncoder returns an encoder for one dimensional arrays.
+func ArrayEncoder[T any](
+	delim byte,
+	appendElement func(b []byte, v T) []byte,
+) func(b []byte, v []T) []byte {
+	return func(b []byte, v []T) []byte {
+		return AppendArray(b, v, delim, appendElement)
+	}
+}
+
+// Value encodes a non-null parameter.
+func Value[T any](v T, appendValue func(b []byte, v T) []byte) RawValue {
+	// an empty value is not NULL
+	return RawValue{Value: appendValue([]byte{}, v)}
+}
+
+// ValidValue encodes an invalid value as NULL.
+func ValidValue[T any](v T, valid bool, appendValue func(b []byte, v T) []byte) RawValue {
+	if !valid {
+		return RawValue{IsNull: true}
+	}
+	return Value(v, appendValue)
+}
+
+// PointerValue encodes a nil pointer as NULL.
+func PointerValue[T any](v *T, appendValue func(b []byte, v T) []byte) RawValue {
+	if v == nil {
+		return RawValue{IsNull: true}
+	}
+	return Value(*v, appendValue)
+}
+
+// Null represents a value that might be NULL,
+// the layout matches the Null types of database/sql.
+type Null[T any] struct {
+	V     T
+	Valid bool // Valid is true if V is not NULL
+}
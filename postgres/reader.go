@@ -178,6 +178,10 @@ func (r *reader) parseComplete() error {
 	return r.expectKind('1')
 }
 
+func (r *reader) bindComplete() error {
+	return r.expectKind('2')
+}
+
 func (r *reader) authentication() (saslAuthMechanism, error) {
 	if err := r.expectKind('R'); err != nil {
 		return saslAuthMechanismNone, err
@@ -578,7 +582,9 @@ func (r *reader) commandComplete() error {
 	}
 	command, ok := commandTypesMapping[string(commandRaw)]
 	if !ok {
-		return fmt.Errorf("unknown command type %q", commandRaw)
+		// commands without a row count, e.g. CREATE TABLE
+		r.c.LastCommand, r.c.LastRowCount = CommandUnknown, 0
+		return nil
 	}
 
 	if command == CommandInsert {
@@ -601,6 +607,14 @@ func (r *reader) commandComplete() error {
 	return nil
 }
 
+func (r *reader) emptyQueryResponse() error {
+	if err := r.expectKind('I'); err != nil {
+		return err
+	}
+	_, err := r.readInt32()
+	return err
+}
+
 func (r *reader) noData() error {
 	if err := r.expectKind('n'); err != nil {
 		return err
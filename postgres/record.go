@@ -0,0 +1,172 @@
+package postgres
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	errInvalidRecord = errors.New("invalid record")
+	ErrRecordLength  = errors.New("unexpected number of record fields")
+)
+
+// ParseRecord parses the text or binary format of a composite value (row value).
+// Field values might reference b.
+func ParseRecord(format int, b []byte) ([]RawValue, error) {
+	switch format {
+	case FormatText:
+		return parseRecordText(b)
+	case FormatBinary:
+		return parseRecordBinary(b)
+	default:
+		return nil, errUnknownFormat
+	}
+}
+
+// parseRecordText parses e.g. (1,,"a ""quoted"" \\ value",""),
+// an unquoted empty field is NULL, a quoted empty field is an empty string.
+func parseRecordText(b []byte) ([]RawValue, error) {
+	if len(b) < 2 || b[0] != '(' || b[len(b)-1] != ')' {
+		return nil, errInvalidRecord
+	}
+	b = b[1 : len(b)-1]
+
+	var fields []RawValue
+	for {
+		var field RawValue
+		quoted := false
+		escaped := false
+		start := 0
+		i := 0
+		var value []byte
+	loop:
+		for ; i < len(b); i++ {
+			ch := b[i]
+			switch {
+			case ch == '"' && quoted && i+1 < len(b) && b[i+1] == '"':
+				value = append(value, '"')
+				escaped = true
+				i++
+			case ch == '"':
+				quoted = !quoted
+				escaped = true
+			case ch == '\\':
+				if i+1 >= len(b) {
+					return nil, errInvalidRecord
+				}
+				value = append(value, b[i+1])
+				escaped = true
+				i++
+			case ch == ',' && !quoted:
+				break loop
+			default:
+				value = append(value, ch)
+			}
+		}
+		if quoted {
+			return nil, errInvalidRecord
+		}
+
+		switch {
+		case escaped:
+			field.Value = value
+			if field.Value == nil {
+				field.Value = []byte{}
+			}
+		case i == start:
+			field.IsNull = true
+		default:
+			field.Value = b[start:i]
+		}
+		fields = append(fields, field)
+
+		if i >= len(b) {
+			return fields, nil
+		}
+		b = b[i+1:]
+	}
+}
+
+func parseRecordBinary(b []byte) ([]RawValue, error) {
+	r := binaryValueReader{b: b}
+	count := r.int32()
+	if r.err != nil || count < 0 || count > len(b) {
+		return nil, errInvalidRecord
+	}
+	fields := make([]RawValue, count)
+	for i := range fields {
+		_ = r.int32() // type oid
+		fields[i] = r.value()
+	}
+	if r.err != nil || len(r.b) != 0 {
+		return nil, errInvalidRecord
+	}
+	return fields, nil
+}
+
+// ParseRecordLength is like ParseRecord, but fails if the number of fields does not match.
+func ParseRecordLength(format int, b []byte, length int) ([]RawValue, error) {
+	fields, err := ParseRecord(format, b)
+	if err != nil {
+		return nil, err
+	}
+	if len(fields) != length {
+		return nil, fmt.Errorf("%w (expected %d, got %d)", ErrRecordLength, length, len(fields))
+	}
+	return fields, nil
+}
+
+// AppendRecord appends the text format, the field values must be in the text format.
+func AppendRecord(b []byte, fields []RawValue) []byte {
+	b = append(b, '(')
+	for i, field := range fields {
+		if i != 0 {
+			b = append(b, ',')
+		}
+		if field.IsNull {
+			continue
+		}
+		b = append(b, '"')
+		for _, ch := range field.Value {
+			if ch == '"' || ch == '\\' {
+				b = append(b, ch)
+			}
+			b = append(b, ch)
+		}
+		b = append(b, '"')
+	}
+	return append(b, ')')
+}
+
+// DecodeRecordField decodes a field returned by ParseRecord, NULL is reported as an error.
+func DecodeRecordField[T any](
+	format int,
+	fields []RawValue,
+	index int,
+	decode func(format int, b []byte) (T, error),
+) (T, error) {
+	v, ok, err := DecodeMaybeRecordField(format, fields, index, decode)
+	if err == nil && !ok {
+		err = fmt.Errorf("record field %d: %w", index+1, ErrNullValue)
+	}
+	return v, err
+}
+
+// DecodeMaybeRecordField is like DecodeRecordField, but returns ok == false for NULL.
+func DecodeMaybeRecordField[T any](
+	format int,
+	fields []RawValue,
+	index int,
+	decode func(format int, b []byte) (T, error),
+) (T, bool, error) {
+	var zero T
+	field := fields[index]
+	if field.IsNull {
+		return zero, false, nil
+	}
+	v, err := decode(format, field.Value)
+	if err != nil {
+		return zero, true, fmt.Errorf("record field %d: %w", index+1, err)
+	}
+	return v, true, nil
+}
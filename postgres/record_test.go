@@ -0,0 +1,42 @@
+package postgres
+
+import (
+	"testing"
+)
+
+func TestParseRecordText(t *testing.T) {
+	input := `(1,,"a ""b"" \\c","",x y)`
+	expected := []RawValue{
+		{Value: []byte("1")},
+		{IsNull: true},
+		{Value: []byte(`a "b" \c`)},
+		{Value: []byte{}},
+		{Value: []byte("x y")},
+	}
+	fields, err := ParseRecord(FormatText, []byte(input))
+	if err != nil || len(fields) != len(expected) {
+		t.Fatalf("got %+v (%v)", fields, err)
+	}
+	for i, field := range fields {
+		if field.IsNull != expected[i].IsNull || string(field.Value) != string(expected[i].Value) {
+			t.Fatalf("field %d: got %+v", i, field)
+		}
+	}
+
+	encoded := AppendRecord(nil, fields)
+	roundTrip, err := ParseRecordLength(FormatText, encoded, len(expected))
+	if err != nil {
+		t.Fatalf("%q: %v", encoded, err)
+	}
+	for i, field := range roundTrip {
+		if field.IsNull != expected[i].IsNull || string(field.Value) != string(expected[i].Value) {
+			t.Fatalf("round trip field %d: got %+v", i, field)
+		}
+	}
+
+	for _, invalid := range []string{"", "(", `("a)`, `(a\)`} {
+		if _, err := ParseRecord(FormatText, []byte(invalid)); err == nil {
+			t.Fatalf("%q: expected error", invalid)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/erikfastermann/sql/postgres"
+	"github.com/erikfastermann/sql/util"
+)
+
+// tableType is a table or view of a configured schema,
+// a row struct is generated for each of them.
+type tableType struct {
+	schema, name string
+	goName       string
+	fields       []field
+}
+
+type pgTable struct {
+	oid          int
+	schema, name string
+}
+
+func getPostgresTables(c *postgres.Conn) ([]pgTable, error) {
+	// tables, views, materialized views, foreign and partitioned tables
+	const query = "select c.oid, n.nspname, c.relname " +
+		"from pg_class c join pg_namespace n on n.oid = c.relnamespace " +
+		"where c.relkind in ('r', 'v', 'm', 'f', 'p') and not c.relispartition " +
+		"order by n.nspname, c.relname"
+	if err := c.RunQuery(query); err != nil {
+		return nil, err
+	}
+	var tables []pgTable
+	for c.NextRow() {
+		tables = append(tables, pgTable{
+			oid:    util.Check2(c.FieldInt(0)),
+			schema: util.Check2(c.FieldString(1)),
+			name:   util.Check2(c.FieldString(2)),
+		})
+	}
+	if err := c.CloseQuery(); err != nil {
+		return nil, err
+	}
+	return tables, nil
+}
+
+// loadTables resolves the row structs of the tables in config.Tables.
+// Tables with the same name in multiple schemas are prefixed with the schema.
+func (b *builder) loadTables() error {
+	if len(b.config.Tables) == 0 {
+		return nil
+	}
+	schemas := make(map[string]bool, len(b.config.Tables))
+	for _, schema := range b.config.Tables {
+		schemas[schema] = true
+	}
+
+	pgTables, err := getPostgresTables(b.conn)
+	if err != nil {
+		return err
+	}
+	columns := make(map[int][]pgAttributeKey)
+	for key, attr := range b.attributes {
+		if key.num > 0 && !attr.dropped {
+			columns[key.relid] = append(columns[key.relid], key)
+		}
+	}
+
+	nameCount := make(map[string]int)
+	for _, t := range pgTables {
+		if schemas[t.schema] {
+			nameCount[t.name]++
+		}
+	}
+
+	for _, t := range pgTables {
+		if !schemas[t.schema] {
+			continue
+		}
+		goName := exportedName(t.name)
+		if nameCount[t.name] > 1 {
+			goName = exportedName(t.schema + "_" + t.name)
+		}
+		table := &tableType{schema: t.schema, name: t.name, goName: goName}
+
+		keys := columns[t.oid]
+		sort.Slice(keys, func(i, j int) bool { return keys[i].num < keys[j].num })
+		for _, key := range keys {
+			attr := b.attributes[key]
+			typ, err := b.resolveType(attr.typeOid)
+			if err != nil {
+				return fmt.Errorf("table %s.%s column %s: %w", t.schema, t.name, attr.name, err)
+			}
+			table.fields = append(table.fields, field{
+				name:    attr.name,
+				typ:     typ,
+				notNull: attr.notNull || typ.notNull,
+				table:   t.name,
+			})
+		}
+
+		if _, ok := b.tablesByGoName[goName]; ok {
+			return fmt.Errorf("table %s.%s: %s is used by multiple tables", t.schema, t.name, goName)
+		}
+		b.tablesByGoName[goName] = table
+		b.tables = append(b.tables, table)
+	}
+	return nil
+}
+
+var errTableColumnsMismatch = errors.New("result columns do not match the table row struct")
+
+// checkTableStruct reports an error if a declaration uses
+// the name of a table row struct, but returns different columns.
+func (b *builder) checkTableStruct(structName string, fields []field) error {
+	table, ok := b.tablesByGoName[structName]
+	if !ok {
+		return nil
+	}
+	err := fmt.Errorf("%w %s (%s.%s)", errTableColumnsMismatch, structName, table.schema, table.name)
+	if len(fields) != len(table.fields) {
+		return err
+	}
+	for i, f := range fields {
+		t := table.fields[i]
+		if f.name != t.name || !sameType(f.typ, t.typ) || f.notNull != t.notNull || f.group != "" {
+			return fmt.Errorf("%w: column %s", err, f.name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCheckTableStruct(t *testing.T) {
+	int8, text := builtinType("int8"), builtinType("text")
+	person := &tableType{
+		schema: "public",
+		name:   "person",
+		goName: "Person",
+		fields: []field{
+			{name: "id", typ: int8, notNull: true},
+			{name: "name", typ: text},
+		},
+	}
+	b := &builder{tablesByGoName: map[string]*tableType{"Person": person}}
+
+	if err := b.checkTableStruct("Person", person.fields); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.checkTableStruct("Other", person.fields[:1]); err != nil {
+		t.Fatal(err)
+	}
+	// overrides in the header create a new, but equal type
+	copied := *text
+	overridden := []field{person.fields[0], {name: "name", typ: &copied}}
+	if err := b.checkTableStruct("Person", overridden); err != nil {
+		t.Fatal(err)
+	}
+	for _, fields := range [][]field{
+		person.fields[:1],
+		{{name: "id", typ: int8, notNull: true}, {name: "name", typ: text, notNull: true}},
+		{{name: "id", typ: int8, notNull: true}, {name: "nickname", typ: text}},
+		{{name: "id", typ: withGoType(int8, "int"), notNull: true}, {name: "name", typ: text}},
+	} {
+		if err := b.checkTableStruct("Person", fields); !errors.Is(err, errTableColumnsMismatch) {
+			t.Fatalf("%+v: expected errTableColumnsMismatch, got %v", fields, err)
+		}
+	}
+}
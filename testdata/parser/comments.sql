@@ -0,0 +1,15 @@
+/* block comments can be nested:
+/* inner
+--- NotADeclaration
+*/
+still a comment
+
+--- Outer? is also not a declaration
+*/
+
+--- GetUser?
+select * from users where id = $1 /* a trailing
+--- comment */ and name = $2
+
+	--- IndentedOne!
+	select 1 -- a line comment --- NotADeclaration
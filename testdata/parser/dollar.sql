@@ -0,0 +1,19 @@
+create function bump() returns trigger as $$
+begin
+--- NotADeclaration
+
+	new.updated = now();
+	return new;
+end
+$$ language plpgsql;
+
+--- Block(nested)
+do $body$
+begin
+	perform $$ $inner$ --- NotADeclaration $inner$ $$;
+
+end
+$body$
+
+--- Price! {0: notnull}
+select $1::numeric as price, $ok$it's$ok$ as text
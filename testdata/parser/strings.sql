@@ -0,0 +1,13 @@
+--- Escaped!
+select E'it\'s \\' as a, e'\'' as b, 'it''s' as c
+
+--- Unicode!
+select U&'d\0061t\+000061' as a, U&"d!0061t" uescape '!' as b
+
+--- MultiLine!
+select '
+--- NotADeclaration
+
+' as text, "quoted
+--- NotADeclaration
+identifier" from t
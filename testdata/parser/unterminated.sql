@@ -0,0 +1,5 @@
+--- Broken!
+select 1
+
+/* /* nested
+*/
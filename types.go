@@ -0,0 +1,491 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/erikfastermann/sql/postgres"
+	"github.com/erikfastermann/sql/util"
+)
+
+type pgType struct {
+	namespace string
+	name      string
+	kind      byte // pg_type.typtype
+	category  byte
+	elemOid   int // only set for arrays
+	arrayOid  int // pg_type.typarray, the array type of this type
+	delimiter byte
+	relid     int // only set for composite types
+	baseOid   int // only set for domains
+	notNull   bool
+}
+
+const (
+	pgTypeKindComposite = 'c'
+	pgTypeKindEnum      = 'e'
+	pgTypeKindDomain    = 'd'
+	pgTypeKindPseudo    = 'p'
+	pgTypeKindBase      = 'b'
+	pgTypeCategoryArray = 'A'
+
+	pgCatalog = "pg_catalog"
+)
+
+func getPostgresTypes(c *postgres.Conn) (map[int]pgType, error) {
+	const query = "select t.oid, n.nspname, t.typname, t.typtype, t.typcategory, t.typelem, " +
+		"t.typdelim, t.typrelid, t.typbasetype, t.typnotnull, t.typarray " +
+		"from pg_type t join pg_namespace n on n.oid = t.typnamespace"
+	if err := c.RunQuery(query); err != nil {
+		return nil, err
+	}
+	types := make(map[int]pgType)
+	arrayElems := make(map[int]int)
+	for c.NextRow() {
+		oid := util.Check2(c.FieldInt(0))
+		nspname := util.Check2(c.FieldString(1))
+		typname := util.Check2(c.FieldString(2))
+		typtype := c.FieldBorrowRawBytes(3)
+		typcategory := c.FieldBorrowRawBytes(4)
+		typelem := util.Check2(c.FieldInt(5))
+		typdelim := c.FieldBorrowRawBytes(6)
+		typrelid := util.Check2(c.FieldInt(7))
+		typbasetype := util.Check2(c.FieldInt(8))
+		typnotnull := util.Check2(c.FieldBool(9))
+		typarray := util.Check2(c.FieldInt(10))
+		if len(typtype) != 1 || len(typcategory) != 1 || len(typdelim) != 1 {
+			panic("internal error")
+		}
+
+		if _, ok := types[oid]; ok {
+			panic("internal error")
+		}
+		typ := pgType{
+			namespace: nspname,
+			name:      typname,
+			kind:      typtype[0],
+			category:  typcategory[0],
+			delimiter: typdelim[0],
+			notNull:   typnotnull,
+			arrayOid:  typarray,
+		}
+		// domains share the category of their base type
+		if typ.kind == pgTypeKindBase && typ.category == pgTypeCategoryArray {
+			arrayElems[oid] = typelem
+		}
+		if typ.kind == pgTypeKindComposite {
+			typ.relid = typrelid
+		}
+		if typ.kind == pgTypeKindDomain {
+			typ.baseOid = typbasetype
+		}
+		types[oid] = typ
+	}
+	if err := c.CloseQuery(); err != nil {
+		return nil, err
+	}
+	setArrayElems(types, arrayElems)
+	return types, nil
+}
+
+// setArrayElems sets the element type of the arrays. Types like int2vector
+// and oidvector also have the array category and an element type,
+// but their text format is space separated without braces.
+// Only the array type (typarray) of the element type is a real array.
+func setArrayElems(types map[int]pgType, arrayElems map[int]int) {
+	for oid, elemOid := range arrayElems {
+		if types[elemOid].arrayOid != oid {
+			continue
+		}
+		typ := types[oid]
+		typ.elemOid = elemOid
+		types[oid] = typ
+	}
+}
+
+// getPostgresEnums returns the labels of each enum type in sort order.
+func getPostgresEnums(c *postgres.Conn) (map[int][]string, error) {
+	const query = "select enumtypid, enumlabel from pg_enum order by enumtypid, enumsortorder"
+	if err := c.RunQuery(query); err != nil {
+		return nil, err
+	}
+	enums := make(map[int][]string)
+	for c.NextRow() {
+		enumtypid := util.Check2(c.FieldInt(0))
+		enumlabel := util.Check2(c.FieldString(1))
+		enums[enumtypid] = append(enums[enumtypid], enumlabel)
+	}
+	if err := c.CloseQuery(); err != nil {
+		return nil, err
+	}
+	return enums, nil
+}
+
+const runtimePackage = "github.com/erikfastermann/sql/postgres"
+
+type typeKind int
+
+const (
+	typeScalar typeKind = iota
+	typeArray
+	typeComposite
+	typeEnum
+	typeDomain
+	typeConverted
+)
+
+type nullableStrategy int
+
+const (
+	nullableDefault nullableStrategy = iota // use the configured default
+
+	nullablePointer // *T
+	nullableGeneric // postgres.Null[T]
+	// database/sql.Null*, falls back to nullablePointer
+	// if no matching type exists
+	nullableSQL
+)
+
+func parseNullableStrategy(s string) (nullableStrategy, error) {
+	switch s {
+	case "":
+		return nullableDefault, nil
+	case "pointer":
+		return nullablePointer, nil
+	case "null":
+		return nullableGeneric, nil
+	case "sql":
+		return nullableSQL, nil
+	default:
+		return nullableDefault, fmt.Errorf("unknown nullable strategy %q", s)
+	}
+}
+
+// resolvedType describes how values of a Postgres type
+// are represented and converted in the generated code.
+type resolvedType struct {
+	kind     typeKind
+	postgres string
+	goType   string // same format as TypeInfo.Go
+	notNull  bool   // domain with a NOT NULL constraint
+	nullable nullableStrategy
+
+	// typeScalar, the value is converted if the Go types differ
+	codec runtimeCodec
+
+	// typeArray
+	elem      *resolvedType
+	delimiter byte
+
+	// typeComposite
+	composite *compositeType
+
+	// typeEnum
+	enum *enumType
+
+	// typeDomain, only used if a named type is generated,
+	// otherwise the domain is resolved to its base type
+	domain *domainType
+
+	// typeConverted, goType is converted from and to this type
+	original *resolvedType
+}
+
+// sameType reports if a and b are represented and converted the same way.
+// Go type overrides create new resolved types, so they are compared by value.
+func sameType(a, b *resolvedType) bool {
+	if a == b {
+		return true
+	}
+	if a == nil || b == nil {
+		return false
+	}
+	return a.kind == b.kind &&
+		a.postgres == b.postgres &&
+		a.goType == b.goType &&
+		a.notNull == b.notNull &&
+		nullable(a) == nullable(b) &&
+		a.codec == b.codec &&
+		sameType(a.elem, b.elem) &&
+		a.delimiter == b.delimiter &&
+		a.composite == b.composite &&
+		a.enum == b.enum &&
+		a.domain == b.domain &&
+		sameType(a.original, b.original)
+}
+
+// runtimeCodec references a DecodeX and AppendX function pair of the runtime package.
+type runtimeCodec struct {
+	name   string
+	goType string
+}
+
+var (
+	codecString = runtimeCodec{"String", "string"}
+
+	// Codecs of the types in pg_catalog. The first codec is the default,
+	// the others are used if the configured Go type matches.
+	// Other base types default to string.
+	runtimeCodecs = map[string][]runtimeCodec{
+		"bool":        {{"Bool", "bool"}},
+		"int2":        {{"Int16", "int16"}, {"Int", "int"}},
+		"int4":        {{"Int32", "int32"}, {"Int", "int"}},
+		"int8":        {{"Int64", "int64"}, {"Int", "int"}},
+		"oid":         {{"Int64", "int64"}},
+		"float4":      {{"Float32", "float32"}},
+		"float8":      {{"Float64", "float64"}},
+		"text":        {codecString},
+		"varchar":     {codecString},
+		"bpchar":      {codecString},
+		"name":        {codecString},
+		"char":        {codecString},
+		"bytea":       {{"Bytea", "[]byte"}},
+		"date":        {{"Date", "time.Time"}},
+		"timestamp":   {{"Timestamp", "time.Time"}},
+		"timestamptz": {{"Timestamp", "time.Time"}},
+		"time":        {{"TimeOfDay", "time.Time"}},
+		"timetz":      {{"TimeOfDay", "time.Time"}},
+		"interval":    {{"Interval", runtimePackage + ".Interval"}, {"Duration", "time.Duration"}},
+		"numeric":     {{"Numeric", "string"}, {"BigRat", "*math/big.Rat"}},
+		"uuid":        {{"UUID", "[16]byte"}},
+		"inet":        {{"Prefix", "net/netip.Prefix"}},
+		"cidr":        {{"Prefix", "net/netip.Prefix"}},
+		"json":        {{"JSON", "encoding/json.RawMessage"}},
+		"jsonb":       {{"JSON", "encoding/json.RawMessage"}},
+	}
+)
+
+// newScalarType falls back to the text representation for unknown types,
+// goType is optional.
+func newScalarType(pgTyp pgType, goType string) *resolvedType {
+	codec := codecString
+	if codecs, ok := runtimeCodecs[pgTyp.name]; ok && pgTyp.namespace == pgCatalog {
+		codec = codecs[0]
+		for _, c := range codecs {
+			if c.goType == goType {
+				codec = c
+				break
+			}
+		}
+	}
+	if goType == "" {
+		goType = codec.goType
+	}
+	return &resolvedType{
+		kind:     typeScalar,
+		postgres: pgTyp.name,
+		goType:   goType,
+		codec:    codec,
+	}
+}
+
+var (
+	errCompositeNoFields = errors.New("composite type has no fields")
+	errAnonymousRecord   = errors.New(
+		"anonymous record type is not supported, cast to a composite type",
+	)
+)
+
+// withGoType returns typ represented by goType in the generated code.
+func withGoType(typ *resolvedType, goType string) *resolvedType {
+	if typ.goType == goType {
+		return typ
+	}
+	if typ.kind != typeScalar {
+		return &resolvedType{
+			kind:     typeConverted,
+			postgres: typ.postgres,
+			goType:   goType,
+			notNull:  typ.notNull,
+			nullable: typ.nullable,
+			original: typ,
+		}
+	}
+
+	converted := *typ
+	converted.goType = goType
+	// prefer an alternative codec of the same type without conversion
+	codecs := runtimeCodecs[typ.postgres]
+	for _, c := range codecs {
+		if c != typ.codec {
+			continue
+		}
+		for _, c := range codecs {
+			if c.goType == goType {
+				converted.codec = c
+				break
+			}
+		}
+		break
+	}
+	return &converted
+}
+
+// typeOverride looks up the configured Go type,
+// the schema qualified name takes precedence.
+func (b *builder) typeOverride(pgTyp pgType) (TypeInfo, bool) {
+	if info, ok := b.config.Types[pgTyp.namespace+"."+pgTyp.name]; ok {
+		return info, true
+	}
+	info, ok := b.config.Types[pgTyp.name]
+	return info, ok
+}
+
+type compositeType struct {
+	postgres string
+	goName   string
+	fields   []compositeField
+}
+
+type compositeField struct {
+	name    string
+	goName  string
+	typ     *resolvedType
+	notNull bool
+}
+
+type enumType struct {
+	postgres string
+	goName   string
+	labels   []string
+}
+
+type domainType struct {
+	postgres string
+	goName   string
+	base     *resolvedType
+}
+
+func (b *builder) resolveType(oid int) (*resolvedType, error) {
+	if typ, ok := b.resolvedTypes[oid]; ok {
+		return typ, nil
+	}
+	typ, err := b.resolveTypeUncached(oid)
+	if err != nil {
+		return nil, err
+	}
+	if typ.nullable == nullableDefault {
+		typ.nullable = b.nullable
+	}
+	b.resolvedTypes[oid] = typ
+	return typ, nil
+}
+
+// resolveTypeUncached maps array types without an explicit configuration
+// to a slice of their element type, composite types to a generated struct
+// and enum types to a generated string type.
+// Domains are resolved to their base type or to a generated named type.
+func (b *builder) resolveTypeUncached(oid int) (*resolvedType, error) {
+	pgTyp, ok := b.types[oid]
+	if !ok {
+		return nil, fmt.Errorf("unknown type oid %d", oid)
+	}
+	if info, ok := b.typeOverride(pgTyp); ok {
+		nullable, err := parseNullableStrategy(info.Nullable)
+		if err != nil {
+			return nil, fmt.Errorf("type %s: %w", pgTyp.name, err)
+		}
+		typ := newScalarType(pgTyp, info.Go)
+		typ.nullable = nullable
+		return typ, nil
+	}
+
+	switch {
+	case pgTyp.namespace == pgCatalog && pgTyp.name == "record":
+		return nil, errAnonymousRecord
+	case pgTyp.kind == pgTypeKindDomain:
+		base, err := b.resolveType(pgTyp.baseOid)
+		if err != nil {
+			return nil, fmt.Errorf("base type of domain %s: %w", pgTyp.name, err)
+		}
+		notNull := pgTyp.notNull || base.notNull
+		if !b.config.DomainTypes {
+			typ := *base
+			typ.notNull = notNull
+			return &typ, nil
+		}
+		domain := &domainType{
+			postgres: pgTyp.name,
+			goName:   exportedName(pgTyp.name),
+			base:     base,
+		}
+		return &resolvedType{
+			kind:     typeDomain,
+			postgres: pgTyp.name,
+			goType:   domain.goName,
+			notNull:  notNull,
+			domain:   domain,
+		}, nil
+	case pgTyp.elemOid != 0:
+		elem, err := b.resolveType(pgTyp.elemOid)
+		if err != nil {
+			return nil, fmt.Errorf("element of array %s: %w", pgTyp.name, err)
+		}
+		return &resolvedType{
+			kind:      typeArray,
+			postgres:  pgTyp.name,
+			goType:    "[]" + elem.goType,
+			elem:      elem,
+			delimiter: b.types[pgTyp.elemOid].delimiter,
+		}, nil
+	case pgTyp.kind == pgTypeKindComposite:
+		composite, err := b.resolveComposite(pgTyp)
+		if err != nil {
+			return nil, fmt.Errorf("composite type %s: %w", pgTyp.name, err)
+		}
+		return &resolvedType{
+			kind:      typeComposite,
+			postgres:  pgTyp.name,
+			goType:    composite.goName,
+			composite: composite,
+		}, nil
+	case pgTyp.kind == pgTypeKindEnum:
+		enum := &enumType{
+			postgres: pgTyp.name,
+			goName:   exportedName(pgTyp.name),
+			labels:   b.enums[oid],
+		}
+		return &resolvedType{
+			kind:     typeEnum,
+			postgres: pgTyp.name,
+			goType:   enum.goName,
+			enum:     enum,
+		}, nil
+	case pgTyp.kind == pgTypeKindPseudo:
+		return nil, fmt.Errorf("pseudo type %s is not supported", pgTyp.name)
+	default:
+		// base, range and multirange types
+		return newScalarType(pgTyp, ""), nil
+	}
+}
+
+func (b *builder) resolveComposite(pgTyp pgType) (*compositeType, error) {
+	composite := &compositeType{
+		postgres: pgTyp.name,
+		goName:   exportedName(pgTyp.name),
+	}
+	// dropped columns keep their number
+	for num := 1; ; num++ {
+		attr, ok := b.attributes[pgAttributeKey{relid: pgTyp.relid, num: num}]
+		if !ok {
+			break
+		}
+		if attr.dropped {
+			continue
+		}
+		typ, err := b.resolveType(attr.typeOid)
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %w", attr.name, err)
+		}
+		composite.fields = append(composite.fields, compositeField{
+			name:    attr.name,
+			goName:  exportedName(attr.name),
+			typ:     typ,
+			notNull: attr.notNull || typ.notNull,
+		})
+	}
+	if len(composite.fields) == 0 {
+		return nil, errCompositeNoFields
+	}
+	return composite, nil
+}
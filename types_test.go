@@ -0,0 +1,137 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestResolveDomain(t *testing.T) {
+	const (
+		oidText          = 25
+		oidEmail         = 100000
+		oidRequiredEmail = 100001
+	)
+	b := &builder{
+		config: &config{},
+		types: map[int]pgType{
+			oidText: {namespace: pgCatalog, name: "text", kind: pgTypeKindBase, category: 'S', delimiter: ','},
+			oidEmail: {
+				namespace: "public",
+				name:      "email",
+				kind:      pgTypeKindDomain,
+				category:  'S',
+				baseOid:   oidText,
+			},
+			oidRequiredEmail: {
+				namespace: "public",
+				name:      "required_email",
+				kind:      pgTypeKindDomain,
+				category:  'S',
+				baseOid:   oidEmail,
+				notNull:   true,
+			},
+		},
+		resolvedTypes: make(map[int]*resolvedType),
+	}
+
+	email, err := b.resolveType(oidEmail)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if email.kind != typeScalar || email.goType != "string" || email.notNull {
+		t.Fatalf("email: got %+v", email)
+	}
+	requiredEmail, err := b.resolveType(oidRequiredEmail)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if requiredEmail.kind != typeScalar || !requiredEmail.notNull {
+		t.Fatalf("required_email: got %+v", requiredEmail)
+	}
+
+	b.config.DomainTypes = true
+	b.resolvedTypes = make(map[int]*resolvedType)
+	requiredEmail, err = b.resolveType(oidRequiredEmail)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if requiredEmail.kind != typeDomain ||
+		requiredEmail.goType != "RequiredEmail" ||
+		!requiredEmail.notNull ||
+		requiredEmail.domain.base.goType != "Email" {
+		t.Fatalf("required_email: got %+v", requiredEmail)
+	}
+}
+
+func TestSetArrayElems(t *testing.T) {
+	const (
+		oidInt2       = 21
+		oidInt2Vector = 22
+		oidInt2Array  = 1005
+	)
+	types := map[int]pgType{
+		oidInt2:       {namespace: pgCatalog, name: "int2", kind: pgTypeKindBase, category: 'N', arrayOid: oidInt2Array},
+		oidInt2Vector: {namespace: pgCatalog, name: "int2vector", kind: pgTypeKindBase, category: pgTypeCategoryArray},
+		oidInt2Array:  {namespace: pgCatalog, name: "_int2", kind: pgTypeKindBase, category: pgTypeCategoryArray},
+	}
+	setArrayElems(types, map[int]int{oidInt2Vector: oidInt2, oidInt2Array: oidInt2})
+	if got := types[oidInt2Array].elemOid; got != oidInt2 {
+		t.Fatalf("_int2: got element %d, want %d", got, oidInt2)
+	}
+	if got := types[oidInt2Vector].elemOid; got != 0 {
+		t.Fatalf("int2vector: got element %d, want no element", got)
+	}
+}
+
+func TestResolveOverride(t *testing.T) {
+	const (
+		oidInt4      = 23
+		oidInt4Array = 1007
+		oidNumeric   = 1700
+		oidXML       = 142
+		oidCitext    = 100000
+	)
+	b := &builder{
+		config: &config{
+			Types: map[string]TypeInfo{
+				"public.citext": {Go: "string"},
+				"numeric":       {Go: "*math/big.Rat"},
+			},
+		},
+		types: map[int]pgType{
+			oidInt4:      {namespace: pgCatalog, name: "int4", kind: pgTypeKindBase, category: 'N', delimiter: ','},
+			oidInt4Array: {namespace: pgCatalog, name: "_int4", kind: pgTypeKindBase, elemOid: oidInt4},
+			oidNumeric:   {namespace: pgCatalog, name: "numeric", kind: pgTypeKindBase, category: 'N'},
+			oidXML:       {namespace: pgCatalog, name: "xml", kind: pgTypeKindBase, category: 'U'},
+			oidCitext:    {namespace: "public", name: "citext", kind: pgTypeKindBase, category: 'S'},
+		},
+		resolvedTypes: make(map[int]*resolvedType),
+	}
+
+	cases := []struct {
+		oid    int
+		goType string
+		codec  string
+	}{
+		{oidInt4, "int32", "Int32"},
+		{oidNumeric, "*math/big.Rat", "BigRat"},
+		{oidXML, "string", "String"},
+		{oidCitext, "string", "String"},
+	}
+	for _, test := range cases {
+		typ, err := b.resolveType(test.oid)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if typ.kind != typeScalar || typ.goType != test.goType || typ.codec.name != test.codec {
+			t.Fatalf("oid %d: got %+v", test.oid, typ)
+		}
+	}
+
+	array, err := b.resolveType(oidInt4Array)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if array.kind != typeArray || array.goType != "[]int32" || array.delimiter != ',' {
+		t.Fatalf("_int4: got %+v", array)
+	}
+}